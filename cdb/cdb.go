@@ -0,0 +1,212 @@
+// Package cdb reads and writes constant databases, as described at https://cr.yp.to/cdb/cdb.txt
+//
+// A database starts with 256 pointers to hash tables, followed by the records
+// and then the hash tables themselves. All numbers are 32 bit little endian.
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const headerSize = 256 * 8
+
+// ErrTooLarge is returned when a database would be larger than 4GB.
+var ErrTooLarge = errors.New("cdb: database would be larger than 4GB")
+
+// ErrCorrupt is returned when a database is not a valid constant database.
+var ErrCorrupt = errors.New("cdb: corrupt database")
+
+func hash(key []byte) uint32 {
+	h := uint32(5381)
+	for _, c := range key {
+		h = ((h << 5) + h) ^ uint32(c)
+	}
+	return h
+}
+
+type slot struct {
+	hash uint32
+	pos  uint32
+}
+
+// Writer builds a constant database in memory.
+type Writer struct {
+	records bytes.Buffer
+	tables  [256][]slot
+}
+
+// NewWriter returns an empty Writer.
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// Put adds a record. Keys may be repeated, in which case
+// Get finds the first and ForEach visits them all.
+func (w *Writer) Put(key, value []byte) error {
+	pos := uint64(headerSize) + uint64(w.records.Len())
+	if pos+8+uint64(len(key))+uint64(len(value)) > math.MaxUint32 {
+		return ErrTooLarge
+	}
+	h := hash(key)
+	w.tables[h&0xff] = append(w.tables[h&0xff], slot{hash: h, pos: uint32(pos)})
+	var lens [8]byte
+	binary.LittleEndian.PutUint32(lens[0:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(lens[4:], uint32(len(value)))
+	w.records.Write(lens[:])
+	w.records.Write(key)
+	w.records.Write(value)
+	return nil
+}
+
+// WriteTo writes out the database.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	var header [headerSize]byte
+	var tables bytes.Buffer
+	pos := uint64(headerSize) + uint64(w.records.Len())
+	for i, entries := range w.tables {
+		n := uint32(len(entries) * 2)
+		binary.LittleEndian.PutUint32(header[i*8:], uint32(pos))
+		binary.LittleEndian.PutUint32(header[i*8+4:], n)
+		table := make([]slot, n)
+		for _, e := range entries {
+			j := (e.hash >> 8) % n
+			for table[j].pos != 0 {
+				j = (j + 1) % n
+			}
+			table[j] = e
+		}
+		for _, s := range table {
+			var b [8]byte
+			binary.LittleEndian.PutUint32(b[0:], s.hash)
+			binary.LittleEndian.PutUint32(b[4:], s.pos)
+			tables.Write(b[:])
+		}
+		pos += uint64(n) * 8
+		if pos > math.MaxUint32 {
+			return 0, ErrTooLarge
+		}
+	}
+	var written int64
+	for _, b := range [][]byte{header[:], w.records.Bytes(), tables.Bytes()} {
+		n, err := out.Write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// CDB is a constant database read into memory.
+type CDB struct {
+	data []byte
+}
+
+// New reads a constant database from data.
+func New(data []byte) (*CDB, error) {
+	if len(data) < headerSize {
+		return nil, ErrCorrupt
+	}
+	return &CDB{data: data}, nil
+}
+
+func (c *CDB) uint32At(pos uint32) (uint32, error) {
+	if uint64(pos)+4 > uint64(len(c.data)) {
+		return 0, ErrCorrupt
+	}
+	return binary.LittleEndian.Uint32(c.data[pos:]), nil
+}
+
+// record returns the key and value of the record at pos.
+func (c *CDB) record(pos uint32) ([]byte, []byte, error) {
+	klen, err := c.uint32At(pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	vlen, err := c.uint32At(pos + 4)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := uint64(pos) + 8
+	end := start + uint64(klen) + uint64(vlen)
+	if end > uint64(len(c.data)) {
+		return nil, nil, ErrCorrupt
+	}
+	return c.data[start : start+uint64(klen)], c.data[start+uint64(klen) : end], nil
+}
+
+// Get returns the value of the first record with key.
+func (c *CDB) Get(key []byte) ([]byte, bool, error) {
+	h := hash(key)
+	tpos, err := c.uint32At((h & 0xff) * 8)
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := c.uint32At((h&0xff)*8 + 4)
+	if err != nil {
+		return nil, false, err
+	}
+	if n == 0 {
+		return nil, false, nil
+	}
+	j := (h >> 8) % n
+	for i := uint32(0); i < n; i++ {
+		spos := tpos + ((j+i)%n)*8
+		sh, err := c.uint32At(spos)
+		if err != nil {
+			return nil, false, err
+		}
+		rpos, err := c.uint32At(spos + 4)
+		if err != nil {
+			return nil, false, err
+		}
+		if rpos == 0 {
+			return nil, false, nil
+		}
+		if sh != h {
+			continue
+		}
+		k, v, err := c.record(rpos)
+		if err != nil {
+			return nil, false, err
+		}
+		if bytes.Equal(k, key) {
+			return v, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// ForEach calls fn with every record, in the order they were written.
+func (c *CDB) ForEach(fn func(key, value []byte) error) error {
+	// The records end where the first hash table starts
+	end, err := c.uint32At(0)
+	if err != nil {
+		return err
+	}
+	for i := uint32(1); i < 256; i++ {
+		tpos, err := c.uint32At(i * 8)
+		if err != nil {
+			return err
+		}
+		if tpos < end {
+			end = tpos
+		}
+	}
+	pos := uint32(headerSize)
+	for pos < end {
+		k, v, err := c.record(pos)
+		if err != nil {
+			return err
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+		pos += 8 + uint32(len(k)) + uint32(len(v))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestCDB_roundTrip(t *testing.T) {
+
+	w := NewWriter()
+	expected := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		value := fmt.Sprintf("value%d", i)
+		expected[key] = value
+		if err := w.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A repeated key is kept, but Get finds the first
+	if err := w.Put([]byte("key1"), []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if _, err := w.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range expected {
+		actual, found, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || string(actual) != value {
+			t.Errorf("'%s': expected '%s', got '%s' (found: %t)", key, value, actual, found)
+		}
+	}
+
+	_, found, err := db.Get([]byte("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("Found a key that was never written")
+	}
+
+	count := 0
+	err = db.ForEach(func(key, value []byte) error {
+		if count == 1000 {
+			if string(key) != "key1" || string(value) != "again" {
+				t.Errorf("Expected the repeated key last, got '%s' => '%s'", key, value)
+			}
+		} else if expected[string(key)] != string(value) {
+			t.Errorf("'%s': expected '%s', got '%s'", key, expected[string(key)], value)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1001 {
+		t.Errorf("Expected 1001 records, got %d", count)
+	}
+
+}
+
+func TestCDB_layout(t *testing.T) {
+
+	w := NewWriter()
+	w.Put([]byte("a"), []byte("b"))
+
+	var b bytes.Buffer
+	w.WriteTo(&b)
+
+	// One 8 byte header entry for each of the 256 tables, one 10 byte
+	// record and a table of two 8 byte slots for the record's hash
+	if b.Len() != 2048+10+16 {
+		t.Fatalf("Expected 2074 bytes, got %d", b.Len())
+	}
+
+	h := hash([]byte("a"))
+	data := b.Bytes()
+	table := (h & 0xff) * 8
+	if pos := binary.LittleEndian.Uint32(data[table:]); pos != 2058 {
+		t.Errorf("Expected the table at 2058, got %d", pos)
+	}
+	if n := binary.LittleEndian.Uint32(data[table+4:]); n != 2 {
+		t.Errorf("Expected 2 slots, got %d", n)
+	}
+	if !bytes.Equal(data[2048:2058], []byte{1, 0, 0, 0, 1, 0, 0, 0, 'a', 'b'}) {
+		t.Errorf("Unexpected record %v", data[2048:2058])
+	}
+
+	_, err := New(data[:100])
+	if err != ErrCorrupt {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"github.com/UniversityRadioYork/alias-go/generator"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// daemon regenerates the aliases on an interval, only replacing
+// the aliases file when the aliases in it have changed.
+type daemon struct {
+	configfile string
+	outfile    string
+	// format is the format given on the command line, which overrides the config's
+	format  string
+	force   bool
+	timeout time.Duration
+	// interval is the interval given on the command line, which overrides the config's
+	interval time.Duration
+	metrics  *runMetrics
+	// report is where the report of each run is written, in reportFormat, if it isn't empty
+	report       string
+	reportFormat string
+
+	// running is held for the whole of a run, so runs never overlap
+	running sync.Mutex
+	// written is the format the aliases file was last written in by this daemon
+	written string
+
+	mu     sync.Mutex
+	config utils.Config
+	status daemonStatus
+}
+
+// daemonStatus describes how the daemon's runs have gone.
+type daemonStatus struct {
+	// Last holds the aliases from the last run that succeeded, or nil if none has.
+	Last *generator.Result
+	// LastSuccess is when the last run that succeeded finished.
+	LastSuccess time.Time
+	// LastError is why the last run failed, or nil if it succeeded.
+	LastError error
+	// LastErrorAt is when the last run that failed finished.
+	LastErrorAt time.Time
+	// Reverse indexes Last by recipient, so looking one up doesn't expand every alias.
+	Reverse generator.ReverseIndex
+}
+
+// Last returns the aliases from the last run that succeeded, or nil if none has.
+func (d *daemon) Last() *generator.Result {
+	return d.Status().Last
+}
+
+// Status returns how the daemon's runs have gone.
+func (d *daemon) Status() daemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// currentConfig returns the config along with the format and interval to use.
+func (d *daemon) currentConfig() (utils.Config, string, time.Duration, error) {
+	d.mu.Lock()
+	config := d.config
+	d.mu.Unlock()
+	format := d.format
+	if format == "" {
+		format = config.GetFormat()
+	}
+	if format == "" {
+		format = generator.DefaultFormat
+	}
+	interval := d.interval
+	if interval == 0 {
+		var err error
+		interval, err = config.GetInterval()
+		if err != nil {
+			return config, format, 0, err
+		}
+	}
+	return config, format, interval, nil
+}
+
+// run regenerates the aliases straight away and then every interval, and
+// again whenever reload receives, after re-reading the config.
+// It returns once ctx is done, abandoning any run in progress.
+func (d *daemon) run(ctx context.Context, reload <-chan os.Signal) error {
+	_, _, interval, err := d.currentConfig()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	utils.Logger(ctx).Info("Regenerating the aliases on an interval", "interval", interval)
+	for {
+		d.regenerate(ctx)
+		select {
+		case <-ctx.Done():
+			utils.Logger(ctx).Info("Stopping")
+			return nil
+		case <-ticker.C:
+		case <-reload:
+			if err := d.reload(ctx); err != nil {
+				utils.Logger(ctx).Error("Unable to reload the config, carrying on with the old one", utils.LogFile, d.configfile, utils.LogError, err)
+			} else if _, _, i, err := d.currentConfig(); err == nil && i != interval {
+				interval = i
+				ticker.Reset(interval)
+				utils.Logger(ctx).Info("Regenerating the aliases on an interval", "interval", interval)
+			}
+		}
+	}
+}
+
+// reload re-reads the config, keeping the old one if the new one is invalid.
+func (d *daemon) reload(ctx context.Context) error {
+	config, err := loadConfig(d.configfile)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.config = config
+	d.mu.Unlock()
+	utils.Logger(ctx).Info("Reloaded the config", utils.LogFile, d.configfile)
+	return nil
+}
+
+// regenerate generates the aliases and replaces the aliases file if they have changed,
+// waiting for any run in progress to finish first.
+// A failed run is reported and the aliases file is left as it was.
+func (d *daemon) regenerate(ctx context.Context) error {
+	d.running.Lock()
+	defer d.running.Unlock()
+	start := time.Now()
+	config, format, _, err := d.currentConfig()
+	if err == nil {
+		err = d.regenerateWith(ctx, config, format)
+	}
+	if ctx.Err() == nil {
+		d.metrics.observeRun(time.Since(start), d.Last(), err, d.outfile)
+		if merr := d.metrics.writeFile(config.GetMetricsFile()); merr != nil {
+			utils.Logger(ctx).Warn("Unable to write the metrics file", utils.LogFile, config.GetMetricsFile(), utils.LogError, merr)
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		utils.Logger(ctx).Error("Regenerating failed, keeping the last good aliases", utils.LogError, err)
+		d.mu.Lock()
+		d.status.LastError = err
+		d.status.LastErrorAt = time.Now()
+		d.mu.Unlock()
+	}
+	return err
+}
+
+func (d *daemon) regenerateWith(ctx context.Context, config utils.Config, format string) error {
+	result, snapshot, err := generate(ctx, config, d.timeout, "", d.metrics)
+	if err != nil {
+		return err
+	}
+	if err := writeReport(d.report, d.reportFormat, result); err != nil {
+		utils.Logger(ctx).Warn("Unable to write the report", utils.LogFile, d.report, utils.LogError, err)
+	}
+	current, err := readAliases(ctx, d.outfile, format)
+	// Some formats can read each other, so a change of format always rewrites the file
+	sameFormat := d.written == "" || d.written == format
+	if err == nil && sameFormat && generator.DiffAliases(current, result.Aliases).Empty() {
+		utils.Logger(ctx).Info("No changes, leaving the aliases file alone", utils.LogFile, d.outfile)
+	} else {
+		err = writeAliases(ctx, config, result, d.outfile, format, d.force)
+		if err != nil {
+			return err
+		}
+		utils.Logger(ctx).Info("Replaced the aliases file", utils.LogFile, d.outfile)
+	}
+	d.written = format
+	saveSnapshot(ctx, config, snapshot)
+	reverse := result.Aliases.ReverseIndex()
+	d.mu.Lock()
+	d.status.Last = result
+	d.status.Reverse = reverse
+	d.status.LastSuccess = time.Now()
+	d.status.LastError = nil
+	d.mu.Unlock()
+	return nil
+}
+
+// runDaemon runs d until ctx is done, reloading its config whenever alias-go is hung up.
+func runDaemon(ctx context.Context, d *daemon) error {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	return d.run(ctx, reload)
+}
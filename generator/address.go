@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"errors"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"log/slog"
+	"net/mail"
+	"strings"
+)
+
+// normaliseAddress trims a destination and lower-cases its domain.
+// Addresses must be a bare RFC 5322 addr-spec, and destinations without
+// a domain a valid local part, otherwise an error is returned.
+// Special destinations, such as pipes, are returned as they are.
+func normaliseAddress(d string) (string, error) {
+	d = strings.TrimSpace(d)
+	if d == "" {
+		return "", errors.New("empty address")
+	}
+	// Even special destinations can't contain a line break, which would start a new alias
+	if strings.ContainsAny(d, "\r\n") {
+		return "", errors.New("address contains a line break")
+	}
+	if IsSpecialDestination(d) {
+		return d, nil
+	}
+	if strings.Contains(d, ",") {
+		return "", errors.New("address contains a comma")
+	}
+	i := strings.LastIndex(d, "@")
+	if i < 0 {
+		// Parse it as the local part of an address to check it
+		if _, err := parseAddrSpec(d + "@localhost"); err != nil {
+			return "", err
+		}
+		return d, nil
+	}
+	d = d[:i] + "@" + strings.ToLower(d[i+1:])
+	return parseAddrSpec(d)
+}
+
+// parseAddrSpec parses an address, rejecting display names and angle brackets.
+func parseAddrSpec(s string) (string, error) {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	if a.Name != "" || strings.ContainsAny(s, "<>") {
+		return "", errors.New("address has a display name")
+	}
+	return s, nil
+}
+
+// checkAddress normalises an address headed for alias, logging and
+// reporting why it is rejected along with where it came from.
+func checkAddress(l *slog.Logger, rep *Report, address, alias string, o Origin) (string, bool) {
+	n, err := normaliseAddress(address)
+	if err != nil {
+		args := append([]any{utils.LogAddress, address, utils.LogAlias, alias, utils.LogError, err}, o.logArgs()...)
+		utils.DataQuality(l).Warn("Rejecting an invalid address", args...)
+		object, id := o.object()
+		rep.add(SkipInvalidAddress, object, id, "Invalid address '%s' for '%s', %s: %s", address, alias, err, o)
+		return "", false
+	}
+	return n, true
+}
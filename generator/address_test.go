@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"github.com/UniversityRadioYork/myradio-go"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestGenerator_normaliseAddress(t *testing.T) {
+
+	valid := map[string]string{
+		"someone@example.com":        "someone@example.com",
+		"  someone@example.com\t":    "someone@example.com",
+		"Some.One@Example.COM":       "Some.One@example.com",
+		"\"some one\"@example.com":   "\"some one\"@example.com",
+		"head.of.computing":          "head.of.computing",
+		"|/usr/bin/ticket --queue a": "|/usr/bin/ticket --queue a",
+	}
+
+	for in, expected := range valid {
+		actual, err := normaliseAddress(in)
+		if err != nil {
+			t.Errorf("'%s': expected '%s', got error '%s'", in, expected, err)
+		} else if actual != expected {
+			t.Errorf("'%s': expected '%s', got '%s'", in, expected, actual)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"   ",
+		"someone@example.com, another@example.com",
+		"someone@example.com\nbcc: another@example.com",
+		"Someone <someone@example.com>",
+		"someone@@example.com",
+		"some one@example.com",
+		"someone.@example.com",
+		"head..of.computing",
+		":fail: gone\nroot: evil@example.com",
+		":defer: later\r\nroot: evil@example.com",
+		"|/usr/bin/ticket\nroot: evil@example.com",
+	}
+
+	for _, in := range invalid {
+		if actual, err := normaliseAddress(in); err == nil {
+			t.Errorf("'%s': expected an error, got '%s'", in, actual)
+		}
+	}
+
+}
+
+func TestGenerator_checkAddress(t *testing.T) {
+
+	o := Origin{
+		Generator: GeneratorMailingList,
+		MemberID:  1,
+	}
+
+	actual, ok := checkAddress(slog.Default(), nil, " Someone@EXAMPLE.com ", "computing", o)
+
+	if !ok || actual != "Someone@example.com" {
+		t.Errorf("Expected 'Someone@example.com', got '%s'", actual)
+	}
+
+	report := &Report{}
+	if _, ok := checkAddress(slog.Default(), report, "someone@", "computing", o); ok {
+		t.Error("Expected 'someone@' to be rejected")
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Category != SkipInvalidAddress ||
+		report.Issues[0].Object != ObjectMember || report.Issues[0].ID != 1 {
+		t.Errorf("Expected the rejected address to be reported against member 1, got %v", report.Issues)
+	}
+
+}
+
+type invalidMemberURY struct {
+	uryTest
+}
+
+func (ury invalidMemberURY) GetMiscAliases() ([]myradio.Alias, error) {
+	member := json.RawMessage(`{"memberid": 42, "public_email": "someone@", "receive_email": true}`)
+	return []myradio.Alias{
+		{
+			Id:     7,
+			Source: "misc.source",
+			Destinations: []struct {
+				Atype string `json:"type"`
+				Value *json.RawMessage
+			}{
+				{
+					Atype: "member",
+					Value: &member,
+				},
+			},
+		},
+	}, nil
+}
+
+func TestGenerator_generateMiscAliases_invalidMember(t *testing.T) {
+
+	var buf bytes.Buffer
+	ctx := utils.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&buf, nil)))
+	report := &Report{}
+
+	aliases, err := generateMiscAliases(ctx, utils.ContextFetcher(invalidMemberURY{}), make(Provenance), report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(aliases["misc.source"]) != 0 {
+		t.Errorf("Expected the invalid address to be rejected, got %v", aliases["misc.source"])
+	}
+	if !strings.Contains(buf.String(), "member_id=42") || !strings.Contains(buf.String(), "misc_id=7") {
+		t.Errorf("Expected the rejection to be logged with the member and misc ids, got %s", buf.String())
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Object != ObjectMember || report.Issues[0].ID != 42 {
+		t.Errorf("Expected the rejected address to be reported against member 42, got %v", report.Issues)
+	}
+
+}
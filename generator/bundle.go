@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"context"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"github.com/UniversityRadioYork/myradio-go"
+	"time"
+)
+
+// FetchBundle fetches everything the aliases are generated from: every
+// response Generate would use, with at most limit calls running at once.
+// Like Generate, it only fetches the members of lists with an address and
+// the heads of teams for positions that have an alias but no current officer,
+// and the first call to fail cancels the rest.
+func FetchBundle(ctx context.Context, ury utils.URYFetcherContext, limit int) (*utils.Bundle, error) {
+	if limit < 1 {
+		limit = utils.DefaultConcurrency
+	}
+	ury = utils.NewLimitedFetcher(ury, limit)
+	b := utils.NewBundle(time.Now())
+	calls := []func(context.Context) error{
+		func(ctx context.Context) (err error) {
+			b.Lists, err = ury.GetMailingListsContext(ctx)
+			return
+		},
+		func(ctx context.Context) (err error) {
+			b.MiscAliases, err = ury.GetMiscAliasesContext(ctx)
+			return
+		},
+		func(ctx context.Context) (err error) {
+			b.OfficerPositions, err = ury.GetOfficerAliasesContext(ctx)
+			return
+		},
+		func(ctx context.Context) (err error) {
+			b.MemberAliases, err = ury.GetMemberAliasesContext(ctx)
+			return
+		},
+	}
+	err := forEachContext(ctx, len(calls), len(calls), func(ctx context.Context, i int) error { return calls[i](ctx) })
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([][]myradio.User, len(b.Lists))
+	err = forEachContext(ctx, len(b.Lists), limit, func(ctx context.Context, i int) (err error) {
+		if len(b.Lists[i].Address) == 0 {
+			return nil
+		}
+		members[i], err = ury.GetMailingListMembersContext(ctx, b.Lists[i])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, list := range b.Lists {
+		if len(list.Address) > 0 {
+			b.ListMembers[list.Listid] = members[i]
+		}
+	}
+
+	var teams []myradio.Team
+	seen := make(map[uint64]bool)
+	for _, o := range b.OfficerPositions {
+		if len(o.Alias) > 0 && len(o.Current) == 0 && !seen[o.Team.TeamID] {
+			seen[o.Team.TeamID] = true
+			teams = append(teams, o.Team)
+		}
+	}
+	heads := make([][]myradio.Officer, len(teams))
+	err = forEachContext(ctx, len(teams), limit, func(ctx context.Context, i int) (err error) {
+		heads[i], err = ury.GetHeadOfTeamContext(ctx, teams[i])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, team := range teams {
+		b.TeamHeads[team.TeamID] = heads[i]
+	}
+	return b, nil
+}
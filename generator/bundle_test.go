@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"context"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerator_FetchBundle(t *testing.T) {
+
+	var ury uryTest
+	var config = configTest{
+		SM:          "sm",
+		ASM:         "asm",
+		AllowCycles: true,
+	}
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "bundle.json")
+
+	b, err := FetchBundle(context.Background(), utils.ContextFetcher(ury), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = utils.WriteBundleFile(b, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := utils.NewFileFetcher(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := Generate(ury, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := Generate(f, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertAliases(actual.Aliases, expected.Aliases, t)
+
+}
+
+func TestGenerator_FetchBundle_firstErrorCancels(t *testing.T) {
+
+	ury := &blockingURY{started: make(chan struct{}, 3)}
+	done := make(chan error)
+	go func() {
+		_, err := FetchBundle(context.Background(), ury, 4)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assertErrorMessage(err, "Misc aliases unavailable", t)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the other fetches to be cancelled by the failure")
+	}
+	if ury.cancelled != 3 {
+		t.Errorf("Expected the 3 other fetches to see the context done, got %d", ury.cancelled)
+	}
+
+}
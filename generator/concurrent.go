@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"context"
+	"sync"
+)
+
+// forEach calls fn with every index from 0 to n-1, running at most limit at once.
+// Once a call fails no more are started, and the first error is returned.
+// Callers keep their output deterministic by storing results by index.
+func forEach(n, limit int, fn func(i int) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > n {
+		limit = n
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		next     int
+		firstErr error
+	)
+	// take returns the next index to work on, or false once
+	// everything has been started or something has failed
+	take := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= n || firstErr != nil {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := take(); ok; i, ok = take() {
+				if err := fn(i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// forEachContext is forEach, passing fn a context which is cancelled as soon as
+// a call fails, so the calls already running give up rather than carrying on.
+// The first error is returned rather than the cancellations it causes.
+func forEachContext(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	forEach(n, limit, func(i int) error {
+		err := fn(ctx, i)
+		if err != nil {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+		return err
+	})
+	return firstErr
+}
@@ -0,0 +1,275 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"github.com/UniversityRadioYork/myradio-go"
+	"sync"
+	"testing"
+	"time"
+)
+
+// latencyURY is a fake MyRadio where every call takes latency to answer.
+type latencyURY struct {
+	utils.URYFetcher
+	latency time.Duration
+	lists   int
+	teams   int
+	// failList makes fetching the members of that list fail, if it is not 0
+	failList int
+}
+
+func (ury latencyURY) GetMailingLists() ([]myradio.List, error) {
+	time.Sleep(ury.latency)
+	lists := make([]myradio.List, 0, ury.lists)
+	for i := 1; i <= ury.lists; i++ {
+		lists = append(lists, myradio.List{
+			Listid:  i,
+			Name:    fmt.Sprintf("List %d", i),
+			Address: fmt.Sprintf("list%d", i),
+		})
+	}
+	return lists, nil
+}
+
+func (ury latencyURY) GetMailingListMembers(list myradio.List) ([]myradio.User, error) {
+	time.Sleep(ury.latency)
+	if list.Listid == ury.failList {
+		return nil, errors.New("List unavailable")
+	}
+	members := make([]myradio.User, 0, 5)
+	for i := 1; i <= 5; i++ {
+		members = append(members, myradio.User{
+			MemberID:     list.Listid*10 + i,
+			Email:        fmt.Sprintf("member%d@example.com", list.Listid*10+i),
+			Receiveemail: true,
+		})
+	}
+	return members, nil
+}
+
+func (ury latencyURY) GetMiscAliases() ([]myradio.Alias, error) {
+	time.Sleep(ury.latency)
+	return []myradio.Alias{}, nil
+}
+
+func (ury latencyURY) GetOfficerAliases() ([]myradio.OfficerPosition, error) {
+	time.Sleep(ury.latency)
+	officers := make([]myradio.OfficerPosition, 0, ury.teams)
+	for i := 1; i <= ury.teams; i++ {
+		officers = append(officers, myradio.OfficerPosition{
+			OfficerID: i,
+			Name:      fmt.Sprintf("Vacant %d", i),
+			Alias:     fmt.Sprintf("vacant.%d", i),
+			Team: myradio.Team{
+				TeamID: uint64(i),
+			},
+		})
+	}
+	return officers, nil
+}
+
+func (ury latencyURY) GetMemberAliases() ([]myradio.UserAlias, error) {
+	time.Sleep(ury.latency)
+	return []myradio.UserAlias{}, nil
+}
+
+func (ury latencyURY) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
+	time.Sleep(ury.latency)
+	return []myradio.Officer{
+		{
+			User: myradio.User{
+				MemberID:     int(t.TeamID),
+				Email:        fmt.Sprintf("head%d@example.com", t.TeamID),
+				Receiveemail: true,
+			},
+		},
+	}, nil
+}
+
+func TestGenerator_forEach(t *testing.T) {
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	seen := make([]bool, 50)
+
+	err := forEach(50, 3, func(i int) error {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		seen[i] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most > 3 {
+		t.Errorf("Expected at most 3 calls at once, got %d", most)
+	}
+	for i, s := range seen {
+		if !s {
+			t.Errorf("Index %d was never called", i)
+		}
+	}
+
+	calls := 0
+	err = forEach(50, 1, func(i int) error {
+		calls++
+		if i == 4 {
+			return errors.New("Failed at 4")
+		}
+		return nil
+	})
+
+	assertErrorMessage(err, "Failed at 4", t)
+
+	if calls != 5 {
+		t.Errorf("Expected no calls after the failure, got %d calls", calls)
+	}
+
+}
+
+func TestGenerator_Generate_concurrencyIsDeterministic(t *testing.T) {
+
+	ury := latencyURY{lists: 20, teams: 10}
+
+	sequential, err := Generate(ury, configTest{SM: "vacant.1", ASM: "vacant.2", Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		concurrent, err := Generate(ury, configTest{SM: "vacant.1", ASM: "vacant.2", Concurrency: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if concurrent.Aliases.String() != sequential.Aliases.String() {
+			t.Fatalf("expected \n%s, got \n%s", sequential.Aliases, concurrent.Aliases)
+		}
+	}
+
+	ury.failList = 7
+
+	_, err = Generate(ury, configTest{SM: "vacant.1", ASM: "vacant.2", Concurrency: 8})
+
+	assertErrorMessage(err, "List unavailable", t)
+
+}
+
+func TestGenerator_GenerateContext_timeout(t *testing.T) {
+
+	ury := latencyURY{latency: time.Minute, lists: 20, teams: 10}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := GenerateContext(ctx, utils.ContextFetcher(ury), configTest{SM: "vacant.1", ASM: "vacant.2"})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded, got '%v'", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Expected to give up at the deadline, took %s", time.Since(start))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	_, err = GenerateContext(ctx, utils.ContextFetcher(latencyURY{}), configTest{SM: "vacant.1", ASM: "vacant.2"})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the generation to be cancelled, got '%v'", err)
+	}
+
+}
+
+// blockingURY fails to fetch the misc aliases once the other generators have
+// started, and blocks every other call until its context is done,
+// counting the calls that gave up.
+type blockingURY struct {
+	started   chan struct{}
+	mu        sync.Mutex
+	cancelled int
+}
+
+func (ury *blockingURY) block(ctx context.Context) error {
+	ury.started <- struct{}{}
+	<-ctx.Done()
+	ury.mu.Lock()
+	ury.cancelled++
+	ury.mu.Unlock()
+	return ctx.Err()
+}
+
+func (ury *blockingURY) GetMailingListsContext(ctx context.Context) ([]myradio.List, error) {
+	return nil, ury.block(ctx)
+}
+
+func (ury *blockingURY) GetMailingListMembersContext(ctx context.Context, list myradio.List) ([]myradio.User, error) {
+	return nil, ury.block(ctx)
+}
+
+func (ury *blockingURY) GetMiscAliasesContext(ctx context.Context) ([]myradio.Alias, error) {
+	for i := 0; i < 3; i++ {
+		<-ury.started
+	}
+	return nil, errors.New("Misc aliases unavailable")
+}
+
+func (ury *blockingURY) GetOfficerAliasesContext(ctx context.Context) ([]myradio.OfficerPosition, error) {
+	return nil, ury.block(ctx)
+}
+
+func (ury *blockingURY) GetMemberAliasesContext(ctx context.Context) ([]myradio.UserAlias, error) {
+	return nil, ury.block(ctx)
+}
+
+func (ury *blockingURY) GetHeadOfTeamContext(ctx context.Context, t myradio.Team) ([]myradio.Officer, error) {
+	return nil, ury.block(ctx)
+}
+
+func TestGenerator_GenerateContext_firstErrorCancels(t *testing.T) {
+
+	ury := &blockingURY{started: make(chan struct{}, 3)}
+	done := make(chan error)
+	go func() {
+		_, err := GenerateContext(context.Background(), ury, configTest{SM: "vacant.1", ASM: "vacant.2"})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assertErrorMessage(err, "Misc aliases unavailable", t)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the other generators to be cancelled by the failure")
+	}
+	if ury.cancelled != 3 {
+		t.Errorf("Expected the 3 other fetches to see the context done, got %d", ury.cancelled)
+	}
+
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	ury := latencyURY{latency: time.Millisecond, lists: 40, teams: 20}
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			config := configTest{SM: "vacant.1", ASM: "vacant.2", Concurrency: concurrency}
+			for i := 0; i < b.N; i++ {
+				if _, err := Generate(ury, config); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
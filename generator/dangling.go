@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// The policies for dangling destinations.
+const (
+	// DanglingWarn logs dangling destinations and keeps them, it is the default.
+	DanglingWarn = "warn"
+	// DanglingDrop logs dangling destinations and removes them.
+	DanglingDrop = "drop"
+	// DanglingFail fails the generation if there are any dangling destinations.
+	DanglingFail = "fail"
+)
+
+// Dangling is a local destination, one without a domain, that is
+// neither a generated alias nor a known local mailbox.
+type Dangling struct {
+	Alias       string
+	Destination string
+	Origins     []Origin
+}
+
+func (d Dangling) String() string {
+	str := fmt.Sprintf("'%s' in '%s'", d.Destination, d.Alias)
+	var from []string
+	for _, o := range d.Origins {
+		if o.MiscID != 0 {
+			from = append(from, fmt.Sprintf("misc id: %d, type: %s", o.MiscID, o.DestinationType))
+		} else {
+			from = append(from, o.Generator)
+		}
+	}
+	if len(from) > 0 {
+		str += " (" + strings.Join(from, "; ") + ")"
+	}
+	return str
+}
+
+// logArgs returns d as fields for a log record.
+func (d Dangling) logArgs() []any {
+	origins := make([]string, 0, len(d.Origins))
+	for _, o := range d.Origins {
+		origins = append(origins, o.String())
+	}
+	return []any{utils.LogAlias, d.Alias, utils.LogAddress, d.Destination, "origins", origins}
+}
+
+// findDangling returns every dangling destination, sorted by alias and destination.
+func findDangling(a Aliases, mailboxes []string, p Provenance) []Dangling {
+	known := make(map[string]bool)
+	for _, m := range mailboxes {
+		known[m] = true
+	}
+	var dangling []Dangling
+	for _, s := range sortedKeys(a) {
+		for _, d := range a[s] {
+			if strings.Contains(d, "@") || IsSpecialDestination(d) || a.isAlias(d) || known[d] {
+				continue
+			}
+			dangling = append(dangling, Dangling{
+				Alias:       s,
+				Destination: d,
+				Origins:     p.Of(s, d),
+			})
+		}
+	}
+	sort.SliceStable(dangling, func(i, j int) bool {
+		if dangling[i].Alias != dangling[j].Alias {
+			return dangling[i].Alias < dangling[j].Alias
+		}
+		return dangling[i].Destination < dangling[j].Destination
+	})
+	return dangling
+}
+
+// checkDangling finds dangling destinations and applies the configured policy to them.
+func checkDangling(l *slog.Logger, a *Aliases, c utils.Configurer, p Provenance) ([]Dangling, error) {
+	dangling := findDangling(*a, c.GetLocalMailboxes(), p)
+	if len(dangling) == 0 {
+		return nil, nil
+	}
+	switch c.GetDanglingPolicy() {
+	case DanglingFail:
+		strs := make([]string, 0, len(dangling))
+		for _, d := range dangling {
+			strs = append(strs, d.String())
+		}
+		return nil, fmt.Errorf("Found %d dangling destination(s): %s", len(dangling), strings.Join(strs, "; "))
+	case DanglingDrop:
+		for _, d := range dangling {
+			utils.DataQuality(l).Warn("Dropping a dangling destination", d.logArgs()...)
+			ds := (*a)[d.Alias]
+			n := make([]string, 0, len(ds))
+			for _, dest := range ds {
+				if dest != d.Destination {
+					n = append(n, dest)
+				}
+			}
+			(*a)[d.Alias] = n
+		}
+	default:
+		for _, d := range dangling {
+			utils.DataQuality(l).Warn("Dangling destination", d.logArgs()...)
+		}
+	}
+	return dangling, nil
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func testDanglingAliases() (Aliases, Provenance) {
+	a := Aliases{
+		"events": {
+			"head.of.events",
+			"someone@example.com",
+		},
+		"computing": {
+			"root",
+			"old.computing.list",
+			"|/usr/bin/ticket",
+		},
+		"head.of.events": {
+			"another@example.com",
+		},
+	}
+	p := make(Provenance)
+	p.add("events", "head.of.events", Origin{
+		Generator:       GeneratorMisc,
+		MiscID:          7,
+		DestinationType: "officer",
+	})
+	p.add("computing", "old.computing.list", Origin{
+		Generator:       GeneratorMisc,
+		MiscID:          8,
+		DestinationType: "list",
+	})
+	return a, p
+}
+
+func TestGenerator_findDangling(t *testing.T) {
+
+	a, p := testDanglingAliases()
+
+	actual := findDangling(a, []string{"root"}, p)
+
+	if len(actual) != 1 {
+		t.Fatalf("Expected 1 dangling destination, got %v", actual)
+	}
+
+	expected := "'old.computing.list' in 'computing' (misc id: 8, type: list)"
+
+	if actual[0].String() != expected {
+		t.Errorf("expected \n%s, got \n%s", expected, actual[0].String())
+	}
+
+	delete(a, "head.of.events")
+
+	actual = findDangling(a, []string{"root"}, p)
+
+	if len(actual) != 2 {
+		t.Fatalf("Expected 2 dangling destinations, got %v", actual)
+	}
+
+	expected = "'head.of.events' in 'events' (misc id: 7, type: officer)"
+
+	if actual[1].String() != expected {
+		t.Errorf("expected \n%s, got \n%s", expected, actual[1].String())
+	}
+
+}
+
+func TestGenerator_checkDangling(t *testing.T) {
+
+	a, p := testDanglingAliases()
+	config := configTest{
+		Mailboxes: []string{"root"},
+	}
+
+	dangling, err := checkDangling(slog.Default(), &a, config, p)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dangling) != 1 {
+		t.Errorf("Expected 1 dangling destination, got %v", dangling)
+	}
+	if len(a["computing"]) != 3 {
+		t.Errorf("Warning should keep the destination, got %v", a["computing"])
+	}
+
+	config.Dangling = DanglingDrop
+
+	_, err = checkDangling(slog.Default(), &a, config, p)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertAliases(a, Aliases{
+		"events": {
+			"head.of.events",
+			"someone@example.com",
+		},
+		"computing": {
+			"root",
+			"|/usr/bin/ticket",
+		},
+		"head.of.events": {
+			"another@example.com",
+		},
+	}, t)
+
+	a, p = testDanglingAliases()
+	config.Dangling = DanglingFail
+
+	_, err = checkDangling(slog.Default(), &a, config, p)
+
+	assertErrorMessage(err, "Found 1 dangling destination(s): "+
+		"'old.computing.list' in 'computing' (misc id: 8, type: list)", t)
+
+}
@@ -0,0 +1,175 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Diff holds the semantic differences between two sets of aliases.
+type Diff struct {
+	// Added holds aliases that only exist in the new aliases, with their recipients.
+	Added Aliases
+	// Removed holds aliases that only exist in the old aliases, with their recipients.
+	Removed Aliases
+	// Changed holds aliases that exist in both but whose recipients differ.
+	Changed []AliasChange
+}
+
+// AliasChange holds the recipients added to and removed from an alias.
+type AliasChange struct {
+	Alias   string
+	Added   []string
+	Removed []string
+}
+
+// DiffAliases compares two sets of aliases alias by alias.
+// Aliases without any destinations are treated as not existing,
+// as they are never written out.
+func DiffAliases(old, new Aliases) Diff {
+	d := Diff{
+		Added:   make(Aliases),
+		Removed: make(Aliases),
+	}
+	for s, ds := range new {
+		if len(old[s]) == 0 && len(ds) > 0 {
+			d.Added[s] = sortedSet(ds)
+		}
+	}
+	for s, ds := range old {
+		if len(new[s]) == 0 && len(ds) > 0 {
+			d.Removed[s] = sortedSet(ds)
+		}
+	}
+	for s, ds := range new {
+		if len(old[s]) == 0 || len(ds) == 0 {
+			continue
+		}
+		oldset := make(map[string]bool)
+		for _, od := range old[s] {
+			oldset[od] = true
+		}
+		newset := make(map[string]bool)
+		for _, nd := range ds {
+			newset[nd] = true
+		}
+		c := AliasChange{Alias: s}
+		for nd := range newset {
+			if !oldset[nd] {
+				c.Added = append(c.Added, nd)
+			}
+		}
+		for od := range oldset {
+			if !newset[od] {
+				c.Removed = append(c.Removed, od)
+			}
+		}
+		if len(c.Added) > 0 || len(c.Removed) > 0 {
+			sort.Strings(c.Added)
+			sort.Strings(c.Removed)
+			d.Changed = append(d.Changed, c)
+		}
+	}
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].Alias < d.Changed[j].Alias
+	})
+	return d
+}
+
+// Empty returns whether there are no differences.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// AddedRecipients returns how many recipients are added, across all aliases.
+func (d Diff) AddedRecipients() int {
+	n := 0
+	for _, ds := range d.Added {
+		n += len(ds)
+	}
+	for _, c := range d.Changed {
+		n += len(c.Added)
+	}
+	return n
+}
+
+// RemovedRecipients returns how many recipients are removed, across all aliases.
+func (d Diff) RemovedRecipients() int {
+	n := 0
+	for _, ds := range d.Removed {
+		n += len(ds)
+	}
+	for _, c := range d.Changed {
+		n += len(c.Removed)
+	}
+	return n
+}
+
+// WriteTo writes the differences in a human readable form,
+// with added lines prefixed by '+' and removed lines by '-'.
+func (d Diff) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(format string, args ...interface{}) error {
+		m, err := fmt.Fprintf(w, format, args...)
+		n += int64(m)
+		return err
+	}
+	for _, s := range sortedKeys(d.Added) {
+		if err := write("+ %s\n", s); err != nil {
+			return n, err
+		}
+		for _, r := range d.Added[s] {
+			if err := write("    + %s\n", r); err != nil {
+				return n, err
+			}
+		}
+	}
+	for _, s := range sortedKeys(d.Removed) {
+		if err := write("- %s\n", s); err != nil {
+			return n, err
+		}
+		for _, r := range d.Removed[s] {
+			if err := write("    - %s\n", r); err != nil {
+				return n, err
+			}
+		}
+	}
+	for _, c := range d.Changed {
+		if err := write("  %s\n", c.Alias); err != nil {
+			return n, err
+		}
+		for _, r := range c.Added {
+			if err := write("    + %s\n", r); err != nil {
+				return n, err
+			}
+		}
+		for _, r := range c.Removed {
+			if err := write("    - %s\n", r); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func sortedKeys(a Aliases) []string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSet(ds []string) []string {
+	found := make(map[string]bool)
+	n := make([]string, 0, len(ds))
+	for _, d := range ds {
+		if !found[d] {
+			found[d] = true
+			n = append(n, d)
+		}
+	}
+	sort.Strings(n)
+	return n
+}
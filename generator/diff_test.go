@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestGenerator_DiffAliases(t *testing.T) {
+
+	old := Aliases{
+		"unchanged": {
+			"a",
+			"b",
+		},
+		"changed": {
+			"a",
+			"b",
+			"b",
+		},
+		"removed": {
+			"c",
+		},
+		"empty": {},
+	}
+
+	new := Aliases{
+		"unchanged": {
+			"b",
+			"a",
+		},
+		"changed": {
+			"b",
+			"d",
+		},
+		"added": {
+			"e",
+			"d",
+		},
+		"empty": {},
+	}
+
+	d := DiffAliases(old, new)
+
+	assertAliases(d.Added, Aliases{"added": {"d", "e"}}, t)
+	assertAliases(d.Removed, Aliases{"removed": {"c"}}, t)
+
+	expected := []AliasChange{
+		{
+			Alias:   "changed",
+			Added:   []string{"d"},
+			Removed: []string{"a"},
+		},
+	}
+
+	if eq := reflect.DeepEqual(expected, d.Changed); !eq {
+		t.Errorf("expected \n%v, got \n%v", expected, d.Changed)
+	}
+
+	if d.AddedRecipients() != 3 || d.RemovedRecipients() != 2 {
+		t.Errorf("Expected 3 recipients added and 2 removed, got %d and %d", d.AddedRecipients(), d.RemovedRecipients())
+	}
+
+	if d.Empty() {
+		t.Error("Diff should not be empty")
+	}
+
+	var buf bytes.Buffer
+	_, err := d.WriteTo(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedStr := "+ added\n    + d\n    + e\n- removed\n    - c\n  changed\n    + d\n    - a\n"
+
+	if buf.String() != expectedStr {
+		t.Errorf("expected \n%s, got \n%s", expectedStr, buf.String())
+	}
+
+	if !DiffAliases(old, old).Empty() {
+		t.Error("Diff against itself should be empty")
+	}
+
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Explain writes out why each recipient of an alias receives its mail.
+// Destinations that are themselves aliases are explained in turn,
+// giving the full chain from the alias to each final recipient.
+func (r *Result) Explain(w io.Writer, name string) error {
+	if _, exists := r.Aliases[name]; !exists {
+		return fmt.Errorf("No alias '%s'", name)
+	}
+	fmt.Fprintln(w, name)
+	r.explain(w, name, 1, map[string]bool{name: true})
+	return nil
+}
+
+func (r *Result) explain(w io.Writer, source string, depth int, seen map[string]bool) {
+	indent := strings.Repeat("  ", depth)
+	dests := append([]string(nil), r.Aliases[source]...)
+	sort.Strings(dests)
+	for _, dest := range dests {
+		fmt.Fprintf(w, "%s%s\n", indent, dest)
+		origins := r.Provenance.Of(source, dest)
+		if len(origins) == 0 {
+			fmt.Fprintf(w, "%s  <- unknown origin\n", indent)
+		}
+		for _, o := range origins {
+			fmt.Fprintf(w, "%s  <- %s\n", indent, o)
+		}
+		if _, isAlias := r.Aliases[dest]; isAlias {
+			if seen[dest] {
+				fmt.Fprintf(w, "%s  (already explained '%s')\n", indent, dest)
+				continue
+			}
+			seen[dest] = true
+			r.explain(w, dest, depth+1, seen)
+		}
+	}
+}
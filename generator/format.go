@@ -0,0 +1,305 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/cdb"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formatter writes aliases as the alias table of a mail server,
+// and reads back aliases it has written.
+type Formatter interface {
+	// Format returns the aliases, starting with header as a comment if the format has comments.
+	Format(ctx context.Context, a Aliases, header string) ([]byte, error)
+	Parse(ctx context.Context, r io.Reader) (Aliases, error)
+}
+
+// Formatters holds every supported format by name.
+var Formatters = map[string]Formatter{
+	"exim":            tableFormat{sep: ": ", end: ", "},
+	"sendmail":        tableFormat{name: "sendmail", sep: ": ", specials: localSpecials},
+	"postfix-aliases": tableFormat{name: "postfix-aliases", sep: ": ", specials: localSpecials},
+	"postfix-virtual": tableFormat{name: "postfix-virtual", sep: " ", specials: noSpecials},
+	"opensmtpd":       tableFormat{name: "opensmtpd", sep: " ", specials: localSpecials},
+	"json":            jsonFormat{},
+	"yaml":            yamlFormat{},
+	"csv":             csvFormat{},
+	"cdb":             cdbFormat{},
+}
+
+// DefaultFormat is the format used when none is given.
+const DefaultFormat = "exim"
+
+// FormatterFor returns the named format, or exim if name is empty.
+func FormatterFor(name string) (Formatter, error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+	f, exists := Formatters[name]
+	if !exists {
+		names := make([]string, 0, len(Formatters))
+		for n := range Formatters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown format '%s', it should be one of: %s", name, strings.Join(names, ", "))
+	}
+	return f, nil
+}
+
+// tableFormat is the line based format shared by exim, sendmail, postfix and opensmtpd,
+// where each alias is followed by sep and its comma separated destinations.
+type tableFormat struct {
+	name string
+	sep  string
+	end  string
+	// specials converts the special destinations, which are exim's, for the format
+	// if it isn't nil
+	specials *specialForms
+}
+
+// specialForms says how the special destinations are written in a format.
+type specialForms struct {
+	// convert returns a special destination as the format writes it,
+	// or an error if the format can't express it
+	convert func(d string) (string, error)
+	// parse returns a destination read from the format as exim would write it
+	parse func(d string) string
+}
+
+// localSpecials are the special destinations of aliases(5) for sendmail and postfix,
+// and of OpenSMTPD's aliases, which deliver to pipes, files and includes,
+// but can't fail or defer mail and discard it by delivering it to /dev/null.
+var localSpecials = &specialForms{
+	convert: func(d string) (string, error) {
+		switch {
+		case d == Blackhole:
+			return "/dev/null", nil
+		case strings.HasPrefix(d, Fail):
+			return "", fmt.Errorf("%s isn't supported", Fail)
+		case strings.HasPrefix(d, Defer):
+			return "", fmt.Errorf("%s isn't supported", Defer)
+		}
+		return d, nil
+	},
+	parse: func(d string) string {
+		if d == "/dev/null" {
+			return Blackhole
+		}
+		return d
+	},
+}
+
+// noSpecials is for formats such as postfix's virtual(5), which only deliver to addresses.
+var noSpecials = &specialForms{
+	convert: func(d string) (string, error) {
+		if IsSpecialDestination(d) {
+			return "", fmt.Errorf("only addresses are supported, not '%s'", d)
+		}
+		return d, nil
+	},
+	parse: func(d string) string { return d },
+}
+
+func (f tableFormat) Format(ctx context.Context, a Aliases, header string) ([]byte, error) {
+	if f.specials != nil {
+		converted := make(Aliases, len(a))
+		for _, s := range sortedKeys(a) {
+			converted[s] = make([]string, 0, len(a[s]))
+			for _, d := range a[s] {
+				c, err := f.specials.convert(d)
+				if err != nil {
+					return nil, fmt.Errorf("Alias '%s' can't be written in the %s format, %s", s, f.name, err)
+				}
+				converted[s] = append(converted[s], c)
+			}
+		}
+		a = converted
+	}
+	return []byte(comment(header) + formatTable(utils.Logger(ctx), a, f.sep, f.end)), nil
+}
+
+func (f tableFormat) Parse(ctx context.Context, r io.Reader) (Aliases, error) {
+	// The ':' after the alias is optional, so one parser reads every variation
+	a, err := ParseAliasesContext(ctx, r)
+	if err != nil || f.specials == nil {
+		return a, err
+	}
+	for _, ds := range a {
+		for i, d := range ds {
+			ds[i] = f.specials.parse(d)
+		}
+	}
+	return a, nil
+}
+
+// jsonFormat is an object of aliases to arrays of destinations.
+type jsonFormat struct{}
+
+func (jsonFormat) Format(ctx context.Context, a Aliases, header string) ([]byte, error) {
+	b, err := json.MarshalIndent(withDestinations(a), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (jsonFormat) Parse(ctx context.Context, r io.Reader) (Aliases, error) {
+	var a Aliases
+	err := json.NewDecoder(r).Decode(&a)
+	return a, err
+}
+
+// yamlFormat is a mapping of aliases to sequences of destinations.
+// Every string is double quoted, so only that subset of YAML is read back.
+type yamlFormat struct{}
+
+func (yamlFormat) Format(ctx context.Context, a Aliases, header string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(comment(header))
+	a = withDestinations(a)
+	for _, s := range sortedKeys(a) {
+		fmt.Fprintf(&b, "%s:\n", strconv.Quote(s))
+		for _, d := range a[s] {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(d))
+		}
+	}
+	return b.Bytes(), nil
+}
+
+func (yamlFormat) Parse(ctx context.Context, r io.Reader) (Aliases, error) {
+	a := make(Aliases)
+	var source string
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+		case strings.HasPrefix(text, "  - "):
+			if source == "" {
+				return nil, fmt.Errorf("line %d: destination without an alias", line)
+			}
+			d, err := strconv.Unquote(strings.TrimPrefix(text, "  - "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			a[source] = append(a[source], d)
+		case strings.HasSuffix(text, ":"):
+			s, err := strconv.Unquote(strings.TrimSuffix(text, ":"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			source = s
+			a[source] = make([]string, 0)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected '%s'", line, text)
+		}
+	}
+	return a, scanner.Err()
+}
+
+// csvFormat has a row for every destination of every alias.
+type csvFormat struct{}
+
+func (csvFormat) Format(ctx context.Context, a Aliases, header string) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"alias", "destination"})
+	a = withDestinations(a)
+	for _, s := range sortedKeys(a) {
+		for _, d := range a[s] {
+			w.Write([]string{s, d})
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func (csvFormat) Parse(ctx context.Context, r io.Reader) (Aliases, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	a := make(Aliases)
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		if len(record) != 2 {
+			return nil, fmt.Errorf("row %d: expected an alias and a destination", i+1)
+		}
+		a[record[0]] = append(a[record[0]], record[1])
+	}
+	return a, nil
+}
+
+// cdbFormat is a constant database for exim's cdb lookups, with a record for each
+// alias whose value is its destinations as they would appear in an exim aliases file.
+// It has no header, as the format has nowhere to put one.
+type cdbFormat struct{}
+
+func (cdbFormat) Format(ctx context.Context, a Aliases, header string) ([]byte, error) {
+	w := cdb.NewWriter()
+	a = withDestinations(a)
+	for _, s := range sortedKeys(a) {
+		err := w.Put([]byte(s), []byte(strings.Join(destinationsToStrings(a[s]), ", ")))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var b bytes.Buffer
+	_, err := w.WriteTo(&b)
+	return b.Bytes(), err
+}
+
+func (cdbFormat) Parse(ctx context.Context, r io.Reader) (Aliases, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	db, err := cdb.New(b)
+	if err != nil {
+		return nil, err
+	}
+	a := make(Aliases)
+	err = db.ForEach(func(key, value []byte) error {
+		ds, err := parseDestinations(string(value))
+		if err != nil {
+			return fmt.Errorf("alias '%s': %s", key, err)
+		}
+		a[string(key)] = ds
+		return nil
+	})
+	return a, err
+}
+
+// withDestinations returns the aliases that have destinations, sorted.
+func withDestinations(a Aliases) Aliases {
+	n := make(Aliases)
+	for s, ds := range a {
+		if len(ds) > 0 {
+			n[s] = append([]string(nil), ds...)
+			sort.Strings(n[s])
+		}
+	}
+	return n
+}
+
+func comment(header string) string {
+	if header == "" {
+		return ""
+	}
+	return "# " + strings.Replace(header, "\n", "\n# ", -1) + "\n"
+}
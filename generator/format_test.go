@@ -0,0 +1,210 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"github.com/UniversityRadioYork/alias-go/cdb"
+	"testing"
+)
+
+func testFormatAliases() Aliases {
+	return Aliases{
+		"root": {
+			"testing",
+			"is",
+			"fun",
+		},
+		"not.root": {
+			"someone@example.com",
+			"|/usr/bin/ticket --queue \"support\"",
+		},
+		"empty": {},
+	}
+}
+
+func TestGenerator_Formatters(t *testing.T) {
+
+	expected := map[string]string{
+		"exim": "# Generated\n" +
+			"not.root: someone@example.com, \"|/usr/bin/ticket --queue \\\"support\\\"\", \n" +
+			"root: fun, is, testing, \n",
+		"sendmail": "# Generated\n" +
+			"not.root: someone@example.com, \"|/usr/bin/ticket --queue \\\"support\\\"\"\n" +
+			"root: fun, is, testing\n",
+		"opensmtpd": "# Generated\n" +
+			"not.root someone@example.com, \"|/usr/bin/ticket --queue \\\"support\\\"\"\n" +
+			"root fun, is, testing\n",
+		"json": "{\n" +
+			"  \"not.root\": [\n" +
+			"    \"someone@example.com\",\n" +
+			"    \"|/usr/bin/ticket --queue \\\"support\\\"\"\n" +
+			"  ],\n" +
+			"  \"root\": [\n" +
+			"    \"fun\",\n" +
+			"    \"is\",\n" +
+			"    \"testing\"\n" +
+			"  ]\n" +
+			"}\n",
+		"yaml": "# Generated\n" +
+			"\"not.root\":\n" +
+			"  - \"someone@example.com\"\n" +
+			"  - \"|/usr/bin/ticket --queue \\\"support\\\"\"\n" +
+			"\"root\":\n" +
+			"  - \"fun\"\n" +
+			"  - \"is\"\n" +
+			"  - \"testing\"\n",
+		"csv": "alias,destination\n" +
+			"not.root,someone@example.com\n" +
+			"not.root,\"|/usr/bin/ticket --queue \"\"support\"\"\"\n" +
+			"root,fun\n" +
+			"root,is\n" +
+			"root,testing\n",
+	}
+
+	for name, str := range expected {
+		f, err := FormatterFor(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := f.Format(context.Background(), testFormatAliases(), "Generated")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != str {
+			t.Errorf("%s: expected \n%s, got \n%s", name, str, actual)
+		}
+	}
+
+}
+
+func TestGenerator_Formatters_roundTrip(t *testing.T) {
+
+	expected := testFormatAliases()
+	delete(expected, "empty")
+
+	for name, f := range Formatters {
+		if name == "postfix-virtual" {
+			// It can't hold the pipe, so is checked in TestGenerator_Formatters_specials
+			continue
+		}
+		b, err := f.Format(context.Background(), testFormatAliases(), "Generated")
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := f.Parse(context.Background(), bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		assertAliases(actual, expected, t)
+	}
+
+}
+
+func TestGenerator_Formatters_specials(t *testing.T) {
+
+	for _, c := range []struct {
+		format   string
+		aliases  Aliases
+		expected string
+		err      string
+	}{
+		{"exim", Aliases{"old.society": {Blackhole, ":fail: Gone"}}, "old.society: :blackhole:, :fail: Gone, \n", ""},
+		{"sendmail", Aliases{"spam": {Blackhole}, "tickets": {"|/usr/bin/ticket"}}, "spam: /dev/null\ntickets: |/usr/bin/ticket\n", ""},
+		{"sendmail", Aliases{"old.society": {"root", ":fail: Gone"}}, "", "Alias 'old.society' can't be written in the sendmail format, :fail: isn't supported"},
+		{"postfix-aliases", Aliases{"spam": {Blackhole}, "extra": {":include:/etc/extra"}}, "extra: :include:/etc/extra\nspam: /dev/null\n", ""},
+		{"postfix-aliases", Aliases{"busy": {":defer: Try later"}}, "", "Alias 'busy' can't be written in the postfix-aliases format, :defer: isn't supported"},
+		{"postfix-virtual", Aliases{"head.of.computing": {"someone@example.com"}}, "head.of.computing someone@example.com\n", ""},
+		{"postfix-virtual", Aliases{"tickets": {"|/usr/bin/ticket"}}, "", "Alias 'tickets' can't be written in the postfix-virtual format, only addresses are supported, not '|/usr/bin/ticket'"},
+		{"postfix-virtual", Aliases{"spam": {Blackhole}}, "", "Alias 'spam' can't be written in the postfix-virtual format, only addresses are supported, not ':blackhole:'"},
+		{"opensmtpd", Aliases{"spam": {Blackhole}, "archive": {"/var/mail/archive"}}, "archive /var/mail/archive\nspam /dev/null\n", ""},
+		{"opensmtpd", Aliases{"old.society": {":fail: Gone"}}, "", "Alias 'old.society' can't be written in the opensmtpd format, :fail: isn't supported"},
+	} {
+		f, err := FormatterFor(c.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := f.Format(context.Background(), c.aliases, "")
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: expected error '%s', got '%v'", c.format, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", c.format, err)
+		}
+		if string(actual) != c.expected {
+			t.Errorf("%s: expected \n%s, got \n%s", c.format, c.expected, actual)
+		}
+		// The converted forms are read back as they were
+		parsed, err := f.Parse(context.Background(), bytes.NewReader(actual))
+		if err != nil {
+			t.Fatalf("%s: %s", c.format, err)
+		}
+		assertAliases(parsed, c.aliases, t)
+	}
+
+}
+
+func TestGenerator_Formatters_cdb(t *testing.T) {
+
+	f, err := FormatterFor("cdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := f.Format(context.Background(), testFormatAliases(), "Generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := cdb.New(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each value should match the text exim would see in an lsearch file
+	expected := map[string]string{
+		"root":     "fun, is, testing",
+		"not.root": "someone@example.com, \"|/usr/bin/ticket --queue \\\"support\\\"\"",
+	}
+
+	for key, value := range expected {
+		actual, found, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Errorf("'%s' not found", key)
+		} else if string(actual) != value {
+			t.Errorf("'%s': expected \n%s, got \n%s", key, value, actual)
+		}
+	}
+
+	_, found, err := db.Get([]byte("empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("Aliases without destinations should not be written")
+	}
+
+}
+
+func TestGenerator_FormatterFor(t *testing.T) {
+
+	f, err := FormatterFor("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != Formatters["exim"] {
+		t.Error("Expected exim to be the default format")
+	}
+
+	_, err = FormatterFor("mbox")
+
+	assertErrorMessage(err, "Unknown format 'mbox', it should be one of: "+
+		"cdb, csv, exim, json, opensmtpd, postfix-aliases, postfix-virtual, sendmail, yaml", t)
+
+}
@@ -1,12 +1,13 @@
 package generator
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/UniversityRadioYork/alias-go/utils"
 	"github.com/UniversityRadioYork/myradio-go"
-	"log"
+	"log/slog"
 	"sort"
 	"strings"
 	"time"
@@ -16,55 +17,167 @@ import (
 // The key is the source and the value is an array of destinations.
 type Aliases map[string][]string
 
+// Result holds the generated aliases along with
+// the provenance of every destination in them.
+type Result struct {
+	Aliases    Aliases
+	Provenance Provenance
+	// Dangling holds the local destinations that lead nowhere.
+	Dangling []Dangling
+	// SnapshotTaken is when the snapshot of MyRadio the aliases were generated
+	// from was taken, or zero if they were generated from MyRadio itself.
+	SnapshotTaken time.Time
+	// Report holds what MyRadio returned that couldn't be used.
+	Report *Report
+}
+
+// The reasons for skipping something MyRadio returned.
+const (
+	SkipListWithoutAddress  = "list_without_address"
+	SkipListWithoutMembers  = "list_without_members"
+	SkipMemberWithoutEmail  = "member_without_email"
+	SkipMiscBlankSource     = "misc_blank_source"
+	SkipOfficerWithoutAlias = "officer_without_alias"
+	SkipMemberAliasBlank    = "member_alias_blank"
+	SkipInvalidAddress      = "invalid_address"
+	SkipTeamWithoutHead     = "team_without_head"
+)
+
+// SkipReasons holds every reason for skipping something.
+var SkipReasons = []string{
+	SkipListWithoutAddress,
+	SkipListWithoutMembers,
+	SkipMemberWithoutEmail,
+	SkipMiscBlankSource,
+	SkipOfficerWithoutAlias,
+	SkipMemberAliasBlank,
+	SkipInvalidAddress,
+	SkipTeamWithoutHead,
+}
+
 // GenerateAliases creates the aliases string using a config.
 // It returns errors at the earliest opportunity.
 func GenerateAliases(ury utils.URYFetcher, c utils.Configurer) (string, error) {
-	err := checkConfig(c)
+	return GenerateAliasesContext(context.Background(), utils.ContextFetcher(ury), c)
+}
+
+// GenerateAliasesContext is GenerateAliases, giving up
+// with the context's error once ctx is done.
+func GenerateAliasesContext(ctx context.Context, ury utils.URYFetcherContext, c utils.Configurer) (string, error) {
+	r, err := GenerateContext(ctx, ury, c)
 	if err != nil {
 		return "", err
 	}
-	// Mailing List Aliases
-	mailing, err := generateMailingListAliases(ury)
+	return formatTable(utils.Logger(ctx), r.Aliases, ": ", ", "), nil
+}
+
+// Generate creates the aliases using a config, recording
+// where each destination came from as it goes.
+// It returns errors at the earliest opportunity.
+func Generate(ury utils.URYFetcher, c utils.Configurer) (*Result, error) {
+	return GenerateContext(context.Background(), utils.ContextFetcher(ury), c)
+}
+
+// GenerateContext is Generate, giving up with the
+// context's error once ctx is done.
+func GenerateContext(ctx context.Context, ury utils.URYFetcherContext, c utils.Configurer) (*Result, error) {
+	err := checkConfig(c)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	limit := c.GetConcurrency()
+	if limit < 1 {
+		limit = utils.DefaultConcurrency
 	}
-	// Misc Aliases
-	misc, err := generateMiscAliases(ury)
+	snapshot, _ := ury.(utils.SnapshotReporter)
+	// Every generator shares the limit on concurrent calls to MyRadio
+	ury = utils.NewLimitedFetcher(ury, limit)
+	// Each generator records its own provenance and report, so they can run at the same time
+	// The first to fail cancels the rest, so they stop calling MyRadio
+	generators := []func(context.Context, Provenance, *Report) (Aliases, error){
+		// Mailing List Aliases
+		func(ctx context.Context, p Provenance, r *Report) (Aliases, error) {
+			return generateMailingListAliases(ctx, ury, p, r, limit)
+		},
+		// Misc Aliases
+		func(ctx context.Context, p Provenance, r *Report) (Aliases, error) {
+			return generateMiscAliases(ctx, ury, p, r)
+		},
+		// Officer Aliases
+		func(ctx context.Context, p Provenance, r *Report) (Aliases, error) {
+			return generateOfficerAliases(ctx, ury, c, p, r, limit)
+		},
+		// User Aliases
+		func(ctx context.Context, p Provenance, r *Report) (Aliases, error) {
+			return generateUserAliases(ctx, ury, p, r)
+		},
+	}
+	generated := make([]Aliases, len(generators))
+	provenances := make([]Provenance, len(generators))
+	reports := make([]*Report, len(generators))
+	err = forEachContext(ctx, len(generators), len(generators), func(ctx context.Context, i int) error {
+		provenances[i] = make(Provenance)
+		reports[i] = &Report{}
+		var err error
+		generated[i], err = generators[i](ctx, provenances[i], reports[i])
+		return err
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	// Officer Aliases
-	officer, err := generateOfficerAliases(ury, c)
+	p := mergeProvenance(provenances...)
+	aliases := mergeAliases(generated...)
+	addManagementFallback(&aliases, c, p)
+	addNonDottedAliases(&aliases, p)
+	addStaticAliases(utils.Logger(ctx), &aliases, c.GetStaticAliases(), p)
+	removeDuplicatesAndBlanks(&aliases, c.GetFoldCase())
+	dangling, err := checkDangling(utils.Logger(ctx), &aliases, c, p)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	// User Aliases
-	user, err := generateUserAliases(ury)
+	err = checkCycles(utils.Logger(ctx), aliases, c)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if c.GetFlattenAliases() {
+		aliases = flattenAliases(aliases, p)
+		removeDuplicatesAndBlanks(&aliases, c.GetFoldCase())
 	}
-	aliases := mergeAliases(mailing, misc, officer, user)
-	addManagementFallback(&aliases, c)
-	addNonDottedAliases(&aliases)
-	removeDuplicatesAndBlanks(&aliases)
-	return aliasesToString(aliases), nil
+	r := &Result{Aliases: aliases, Provenance: p, Dangling: dangling, Report: mergeReports(reports...)}
+	if snapshot != nil {
+		if taken, ok := snapshot.UsedSnapshot(); ok {
+			r.SnapshotTaken = taken
+		}
+	}
+	return r, nil
 }
 
-func generateMailingListAliases(ury utils.URYFetcher) (Aliases, error) {
-	lists, err := ury.GetMailingLists()
+func generateMailingListAliases(ctx context.Context, ury utils.URYFetcherContext, p Provenance, rep *Report, limit int) (Aliases, error) {
+	l := utils.Logger(ctx)
+	lists, err := ury.GetMailingListsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listMembers := make([][]myradio.User, len(lists))
+	err = forEachContext(ctx, len(lists), limit, func(ctx context.Context, i int) error {
+		if len(lists[i].Address) == 0 {
+			return nil
+		}
+		var err error
+		listMembers[i], err = ury.GetMailingListMembersContext(ctx, lists[i])
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	var aliases = make(Aliases)
-	for _, list := range lists {
+	for i, list := range lists {
 		if len(list.Address) == 0 {
-			log.Printf("Skipping list '%s' with id: %d, it has no address", list.Name, list.Listid)
+			utils.DataQuality(l).Warn("Skipping a list with no address", utils.LogListID, list.Listid, utils.LogName, list.Name)
+			rep.add(SkipListWithoutAddress, ObjectList, list.Listid, "List '%s' has no address", list.Name)
 			continue
 		}
-		members, err := ury.GetMailingListMembers(list)
-		if err != nil {
-			return nil, err
-		}
+		members := listMembers[i]
 		if len(members) > 0 {
 			if _, exists := aliases[list.Address]; !exists {
 				aliases[list.Address] = make([]string, 0, list.Recipients)
@@ -72,29 +185,43 @@ func generateMailingListAliases(ury utils.URYFetcher) (Aliases, error) {
 			for _, member := range members {
 				if member.Receiveemail {
 					if member.Email == "" {
-						log.Printf("Member with id: %d has receive_email set to true but has "+
-							"no email set", member.MemberID)
+						utils.DataQuality(l).Warn("Member has receive_email set but no email",
+							utils.LogMemberID, member.MemberID, utils.LogListID, list.Listid)
+						rep.add(SkipMemberWithoutEmail, ObjectMember, member.MemberID,
+							"Member receives email but has no email address, so gets nothing from list '%s'", list.Name)
 					} else {
-						aliases[list.Address] = append(aliases[list.Address], member.Email)
+						o := Origin{
+							Generator: GeneratorMailingList,
+							ListID:    list.Listid,
+							MemberID:  member.MemberID,
+							Detail:    fmt.Sprintf("member of list '%s'", list.Name),
+						}
+						if email, ok := checkAddress(l, rep, member.Email, list.Address, o); ok {
+							aliases[list.Address] = append(aliases[list.Address], email)
+							p.add(list.Address, email, o)
+						}
 					}
 				}
 			}
 		} else {
-			log.Printf("Skipping list '%s' with id: %d, it has no members", list.Name, list.Listid)
+			l.Info("Skipping a list with no members", utils.LogListID, list.Listid, utils.LogName, list.Name)
+			rep.add(SkipListWithoutMembers, ObjectList, list.Listid, "List '%s' (%s) has no members", list.Name, list.Address)
 		}
 	}
 	return aliases, nil
 }
 
-func generateMiscAliases(ury utils.URYFetcher) (Aliases, error) {
-	raws, err := ury.GetMiscAliases()
+func generateMiscAliases(ctx context.Context, ury utils.URYFetcherContext, p Provenance, rep *Report) (Aliases, error) {
+	l := utils.Logger(ctx)
+	raws, err := ury.GetMiscAliasesContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	var aliases = make(Aliases)
 	for _, raw := range raws {
 		if len(raw.Source) == 0 {
-			log.Printf("Skipping due to blank source for misc with id: %d", raw.Id)
+			utils.DataQuality(l).Warn("Skipping a misc alias with a blank source", utils.LogMiscID, raw.Id)
+			rep.add(SkipMiscBlankSource, ObjectMiscAlias, raw.Id, "Misc alias has a blank source")
 			continue
 		}
 		if _, exists := aliases[raw.Source]; !exists {
@@ -102,10 +229,11 @@ func generateMiscAliases(ury utils.URYFetcher) (Aliases, error) {
 		}
 		for _, dest := range raw.Destinations {
 			var deststr string
+			var memberID int
 			var err error
 			switch dest.Atype {
 			case "member":
-				deststr, err = parseMemberAlias(dest.Value)
+				deststr, memberID, err = parseMemberAlias(l, dest.Value)
 			case "text":
 				deststr, err = parseTextAlias(dest.Value)
 			case "officer":
@@ -119,32 +247,58 @@ func generateMiscAliases(ury utils.URYFetcher) (Aliases, error) {
 				return nil, err
 			}
 			if deststr != "" {
-				aliases[raw.Source] = append(aliases[raw.Source], deststr)
+				o := Origin{
+					Generator:       GeneratorMisc,
+					MiscID:          raw.Id,
+					MemberID:        memberID,
+					DestinationType: dest.Atype,
+					Detail:          fmt.Sprintf("misc alias destination of type '%s'", dest.Atype),
+				}
+				if deststr, ok := checkAddress(l, rep, deststr, raw.Source, o); ok {
+					aliases[raw.Source] = append(aliases[raw.Source], deststr)
+					p.add(raw.Source, deststr, o)
+				}
 			}
 		}
 	}
 	return aliases, nil
 }
 
-func generateOfficerAliases(ury utils.URYFetcher, c utils.Configurer) (Aliases, error) {
-	officers, err := ury.GetOfficerAliases()
+func generateOfficerAliases(ctx context.Context, ury utils.URYFetcherContext, c utils.Configurer, p Provenance, rep *Report, limit int) (Aliases, error) {
+	l := utils.Logger(ctx)
+	officers, err := ury.GetOfficerAliasesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Positions without a current officer defer to the head of their team,
+	// so fetch those up front
+	heads := make([][]myradio.Officer, len(officers))
+	err = forEachContext(ctx, len(officers), limit, func(ctx context.Context, i int) error {
+		if len(officers[i].Alias) == 0 || len(officers[i].Current) > 0 {
+			return nil
+		}
+		var err error
+		heads[i], err = ury.GetHeadOfTeamContext(ctx, officers[i].Team)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	var aliases = make(Aliases)
-	for _, officer := range officers {
+	for i, officer := range officers {
 		if len(officer.Alias) == 0 {
-			log.Printf("Skipping officer '%s' with id: %d as it has no alias", officer.Name, officer.OfficerID)
+			l.Debug("Skipping an officer with no alias", utils.LogOfficerID, officer.OfficerID, utils.LogName, officer.Name)
+			rep.add(SkipOfficerWithoutAlias, ObjectOfficer, officer.OfficerID, "Officer '%s' has no alias", officer.Name)
 			continue
 		}
 		if _, exists := aliases[officer.Alias]; !exists {
 			aliases[officer.Alias] = make([]string, 0)
 		}
-		err = addCurrentOfficers(&aliases, officer, ury, c)
+		err = addCurrentOfficers(l, rep, &aliases, officer, heads[i], c, p)
 		if err != nil {
 			return nil, err
 		}
-		err = addHistoricalOfficers(&aliases, officer, c)
+		err = addHistoricalOfficers(l, rep, &aliases, officer, c, p)
 		if err != nil {
 			return nil, err
 		}
@@ -152,29 +306,42 @@ func generateOfficerAliases(ury utils.URYFetcher, c utils.Configurer) (Aliases,
 	return aliases, nil
 }
 
-func generateUserAliases(ury utils.URYFetcher) (Aliases, error) {
-	var userAliases, err = ury.GetMemberAliases()
+func generateUserAliases(ctx context.Context, ury utils.URYFetcherContext, p Provenance, rep *Report) (Aliases, error) {
+	l := utils.Logger(ctx)
+	var userAliases, err = ury.GetMemberAliasesContext(ctx)
 	var aliases = make(Aliases)
 	if err != nil {
 		return nil, err
 	}
 	for _, v := range userAliases {
 		if v.Source == "" || v.Destination == "" {
-			log.Printf("Blank source or destination for member '%s' => '%s'", v.Source, v.Destination)
+			utils.DataQuality(l).Warn("Skipping a member alias with a blank source or destination",
+				utils.LogAlias, v.Source, utils.LogAddress, v.Destination)
+			rep.add(SkipMemberAliasBlank, ObjectMemberAlias, 0,
+				"Member alias has a blank source or destination: '%s' to '%s'", v.Source, v.Destination)
+			continue
+		}
+		o := Origin{
+			Generator: GeneratorUser,
+			Detail:    "member alias",
+		}
+		dest, ok := checkAddress(l, rep, v.Destination, v.Source, o)
+		if !ok {
 			continue
 		}
 		if _, exists := aliases[v.Source]; exists {
-			aliases[v.Source] = append(aliases[v.Source], v.Destination)
+			aliases[v.Source] = append(aliases[v.Source], dest)
 		} else {
-			aliases[v.Source] = []string{v.Destination}
+			aliases[v.Source] = []string{dest}
 		}
+		p.add(v.Source, dest, o)
 	}
 	return aliases, nil
 }
 
 // addNonDottedAliases adds an alias for emails that have '.' in them
 // eg 'head.of.computing' would need an alias from 'headofcomputing'
-func addNonDottedAliases(a *Aliases) {
+func addNonDottedAliases(a *Aliases, p Provenance) {
 	n := make(Aliases)
 	for s := range *a {
 		if strings.Contains(s, ".") {
@@ -184,12 +351,21 @@ func addNonDottedAliases(a *Aliases) {
 			} else {
 				n[nd] = []string{s}
 			}
+			p.add(nd, s, nonDottedOrigin(s))
 		}
 	}
 	(*a) = mergeAliases(*a, n)
 	return
 }
 
+// nonDottedOrigin is the origin of the non-dotted form of source.
+func nonDottedOrigin(source string) Origin {
+	return Origin{
+		Generator: GeneratorNonDotted,
+		Detail:    fmt.Sprintf("non-dotted form of '%s'", source),
+	}
+}
+
 // mergeAliases takes an amount of aliases and combines them.
 // It does *not* check for duplicates as this would take longer.
 func mergeAliases(args ...Aliases) Aliases {
@@ -206,7 +382,18 @@ func mergeAliases(args ...Aliases) Aliases {
 	return merged
 }
 
+// String returns the aliases in the exim aliases file format.
+func (a Aliases) String() string {
+	return aliasesToString(a)
+}
+
 func aliasesToString(a Aliases) string {
+	return formatTable(slog.Default(), a, ": ", ", ")
+}
+
+// formatTable writes one line per alias, with the alias and its destinations
+// separated by sep, the destinations separated by commas and each line ending in end.
+func formatTable(l *slog.Logger, a Aliases, sep, end string) string {
 	// Because it's nice to generate the aliases
 	// in alphabetical order, and to make the tests
 	// pass 100% of the time, we make an array of the
@@ -220,21 +407,42 @@ func aliasesToString(a Aliases) string {
 	for _, key := range keys {
 		if len(a[key]) > 0 {
 			sort.Strings(a[key])
-			str += key + ": " + strings.Join(a[key], ", ") + ", \n"
+			str += quoteAlias(key) + sep + strings.Join(destinationsToStrings(a[key]), ", ") + end + "\n"
 		} else {
-			log.Printf("Skipping writing source '%s', as it has no destinations", key)
+			l.Debug("Skipping writing an alias with no destinations", utils.LogAlias, key)
 		}
 	}
 	return str
 }
 
-func removeDuplicatesAndBlanks(a *Aliases) {
+// destinationsToStrings quotes destinations where needed, moving any
+// :fail: or :defer: to the end as their message runs to the end of the line.
+func destinationsToStrings(ds []string) []string {
+	strs := make([]string, 0, len(ds))
+	var last []string
+	for _, d := range ds {
+		if strings.HasPrefix(d, Fail) || strings.HasPrefix(d, Defer) {
+			last = append(last, quoteDestination(d))
+		} else {
+			strs = append(strs, quoteDestination(d))
+		}
+	}
+	return append(strs, last...)
+}
+
+// removeDuplicatesAndBlanks removes blank and repeated destinations,
+// ignoring case when comparing them if foldCase is set.
+func removeDuplicatesAndBlanks(a *Aliases, foldCase bool) {
 	for s, ds := range *a {
 		found := make(map[string]bool)
 		n := make([]string, 0, len(ds))
 		for _, d := range ds {
-			if d != "" && !found[d] {
-				found[d] = true
+			key := d
+			if foldCase {
+				key = strings.ToLower(d)
+			}
+			if d != "" && !found[key] {
+				found[key] = true
 				n = append(n, d)
 			}
 		}
@@ -260,17 +468,17 @@ func parseOfficerAlias(raw *json.RawMessage) (string, error) {
 	return result.Alias, nil
 }
 
-func parseMemberAlias(raw *json.RawMessage) (string, error) {
+func parseMemberAlias(l *slog.Logger, raw *json.RawMessage) (string, int, error) {
 	var result myradio.User
 	err := json.Unmarshal(*raw, &result)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	if result.Receiveemail {
-		return result.Email, nil
+		return result.Email, result.MemberID, nil
 	} else {
-		log.Printf("memberid %d has receive_email set to false", result.MemberID)
-		return "", nil
+		l.Debug("Member has receive_email unset", utils.LogMemberID, result.MemberID)
+		return "", result.MemberID, nil
 	}
 }
 
@@ -283,27 +491,38 @@ func parseListAlias(raw *json.RawMessage) (string, error) {
 	return result.Address, nil
 }
 
-func addCurrentOfficers(a *Aliases, o myradio.OfficerPosition, ury utils.URYFetcher, c utils.Configurer) error {
+func addCurrentOfficers(l *slog.Logger, rep *Report, a *Aliases, o myradio.OfficerPosition, heads []myradio.Officer, c utils.Configurer, p Provenance) error {
 	if len(o.Current) > 0 {
 		for _, officer := range o.Current {
 			if officer.Receiveemail {
 				if officer.Email == "" {
-					log.Printf("Member with id: %d has receive_email set to true but has "+
-						"no email set", officer.MemberID)
+					utils.DataQuality(l).Warn("Member has receive_email set but no email",
+						utils.LogMemberID, officer.MemberID, utils.LogOfficerID, o.OfficerID)
+					rep.add(SkipMemberWithoutEmail, ObjectMember, officer.MemberID,
+						"Member receives email but has no email address, so gets nothing as '%s'", o.Name)
 				} else {
-					(*a)[o.Alias] = append((*a)[o.Alias], officer.Email)
+					origin := Origin{
+						Generator: GeneratorOfficer,
+						OfficerID: o.OfficerID,
+						MemberID:  officer.MemberID,
+						Detail:    fmt.Sprintf("current holder of '%s'", o.Name),
+					}
+					if email, ok := checkAddress(l, rep, officer.Email, o.Alias, origin); ok {
+						(*a)[o.Alias] = append((*a)[o.Alias], email)
+						p.add(o.Alias, email, origin)
+					}
 				}
 			}
 		}
 		return nil
 	} else {
-		log.Printf("No current officer '%s' in team: '%d '%s', deferring to head of team",
-			o.Name, o.Team.TeamID, o.Team.Name)
-		return addHeadOfTeam(a, o, ury, c)
+		l.Info("No current officer, deferring to the head of team",
+			utils.LogOfficerID, o.OfficerID, utils.LogName, o.Name, utils.LogTeamID, o.Team.TeamID)
+		return addHeadOfTeam(l, rep, a, o, heads, c, p)
 	}
 }
 
-func addHistoricalOfficers(a *Aliases, o myradio.OfficerPosition, c utils.Configurer) error {
+func addHistoricalOfficers(l *slog.Logger, rep *Report, a *Aliases, o myradio.OfficerPosition, c utils.Configurer, p Provenance) error {
 
 	for _, officer := range o.History {
 		v, err := c.IsHistoricalOfficerValid(time.Now(), officer.To)
@@ -313,10 +532,22 @@ func addHistoricalOfficers(a *Aliases, o myradio.OfficerPosition, c utils.Config
 		if v {
 			if officer.User.Receiveemail {
 				if officer.User.Email == "" {
-					log.Printf("Member with id: %d has receive_email set to true but has "+
-						"no email set", officer.User.MemberID)
+					utils.DataQuality(l).Warn("Member has receive_email set but no email",
+						utils.LogMemberID, officer.User.MemberID, utils.LogOfficerID, o.OfficerID)
+					rep.add(SkipMemberWithoutEmail, ObjectMember, officer.User.MemberID,
+						"Member receives email but has no email address, so gets nothing as a previous '%s'", o.Name)
 				} else {
-					(*a)[o.Alias] = append((*a)[o.Alias], officer.User.Email)
+					origin := Origin{
+						Generator: GeneratorOfficer,
+						OfficerID: o.OfficerID,
+						MemberID:  officer.User.MemberID,
+						To:        officer.To,
+						Detail:    fmt.Sprintf("previous holder of '%s', still within the stand down period", o.Name),
+					}
+					if email, ok := checkAddress(l, rep, officer.User.Email, o.Alias, origin); ok {
+						(*a)[o.Alias] = append((*a)[o.Alias], email)
+						p.add(o.Alias, email, origin)
+					}
 				}
 			}
 		}
@@ -324,41 +555,81 @@ func addHistoricalOfficers(a *Aliases, o myradio.OfficerPosition, c utils.Config
 	return nil
 }
 
-func addHeadOfTeam(a *Aliases, o myradio.OfficerPosition, ury utils.URYFetcher, c utils.Configurer) error {
-	heads, err := ury.GetHeadOfTeam(o.Team)
-	if err != nil {
-		return err
-	}
+func addHeadOfTeam(l *slog.Logger, rep *Report, a *Aliases, o myradio.OfficerPosition, heads []myradio.Officer, c utils.Configurer, p Provenance) error {
 	if len(heads) > 0 {
 		for _, head := range heads {
 			if head.User.Receiveemail {
 				if head.User.Email == "" {
-					log.Printf("Member with id: %d has receive_email set to true but has "+
-						"no email set", head.User.MemberID)
+					utils.DataQuality(l).Warn("Member has receive_email set but no email",
+						utils.LogMemberID, head.User.MemberID, utils.LogTeamID, o.Team.TeamID)
+					rep.add(SkipMemberWithoutEmail, ObjectMember, head.User.MemberID,
+						"Member receives email but has no email address, so gets nothing as head of team '%s'", o.Team.Name)
 				} else {
-					(*a)[o.Alias] = append((*a)[o.Alias], head.User.Email)
+					origin := Origin{
+						Generator: GeneratorOfficer,
+						OfficerID: o.OfficerID,
+						TeamID:    int(o.Team.TeamID),
+						MemberID:  head.User.MemberID,
+						Detail:    fmt.Sprintf("head of team '%s', as '%s' has no current holder", o.Team.Name, o.Name),
+					}
+					if email, ok := checkAddress(l, rep, head.User.Email, o.Alias, origin); ok {
+						(*a)[o.Alias] = append((*a)[o.Alias], email)
+						p.add(o.Alias, email, origin)
+					}
 				}
 			}
 		}
 	} else {
-		log.Printf("Deferring head of team '%s' with id: %d to (assistant) station manager", o.Team.Name, o.OfficerID)
+		utils.DataQuality(l).Warn("Team has no head, deferring to station management",
+			utils.LogTeamID, o.Team.TeamID, utils.LogName, o.Team.Name, utils.LogOfficerID, o.OfficerID)
+		rep.add(SkipTeamWithoutHead, ObjectTeam, int(o.Team.TeamID),
+			"Team '%s' has no head, so '%s' goes to station management", o.Team.Name, o.Name)
+		fallback := c.GetHeadOfStation()
 		if o.Alias == c.GetHeadOfStation() {
-			(*a)[o.Alias] = append((*a)[o.Alias], c.GetAssistantHeadOfStation())
-		} else {
-			(*a)[o.Alias] = append((*a)[o.Alias], c.GetHeadOfStation())
+			fallback = c.GetAssistantHeadOfStation()
 		}
+		(*a)[o.Alias] = append((*a)[o.Alias], fallback)
+		p.add(o.Alias, fallback, Origin{
+			Generator: GeneratorOfficer,
+			OfficerID: o.OfficerID,
+			TeamID:    int(o.Team.TeamID),
+			Detail:    fmt.Sprintf("team '%s' has no head, falling back to station management", o.Team.Name),
+		})
 	}
 	return nil
 }
 
-func addManagementFallback(a *Aliases, c utils.Configurer) {
+func addManagementFallback(a *Aliases, c utils.Configurer, p Provenance) {
 	// Fall back to ASM if there is no SM
 	if h, exists := (*a)[c.GetHeadOfStation()]; !exists || len(h) == 0 {
 		if !exists {
 			(*a)[c.GetHeadOfStation()] = make([]string, 0, 1)
 		}
 		(*a)[c.GetHeadOfStation()] = append((*a)[c.GetHeadOfStation()], c.GetAssistantHeadOfStation())
+		p.add(c.GetHeadOfStation(), c.GetAssistantHeadOfStation(), Origin{
+			Generator: GeneratorFallback,
+			Detail:    "there is no head of station, falling back to the assistant",
+		})
+	}
+}
+
+// checkCycles fails if any aliases loop, unless the config allows it.
+func checkCycles(l *slog.Logger, a Aliases, c utils.Configurer) error {
+	cycles := FindCycles(a)
+	if len(cycles) == 0 {
+		return nil
 	}
+	paths := make([]string, 0, len(cycles))
+	for _, cycle := range cycles {
+		paths = append(paths, strings.Join(cycle, " -> "))
+	}
+	if c.GetAllowCycles() {
+		for _, path := range paths {
+			l.Warn("Alias loop", "loop", path)
+		}
+		return nil
+	}
+	return fmt.Errorf("Found %d alias loop(s): %s", len(cycles), strings.Join(paths, "; "))
 }
 
 func checkConfig(c utils.Configurer) error {
@@ -368,5 +639,10 @@ func checkConfig(c utils.Configurer) error {
 	if c.GetAssistantHeadOfStation() == "" {
 		return errors.New("No ASM set in config")
 	}
+	switch c.GetDanglingPolicy() {
+	case "", DanglingWarn, DanglingDrop, DanglingFail:
+	default:
+		return fmt.Errorf("Invalid DanglingPolicy '%s', it should be warn, drop or fail", c.GetDanglingPolicy())
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/UniversityRadioYork/alias-go/utils"
@@ -362,10 +363,17 @@ func (ury uryTest) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
 
 type configTest struct {
 	utils.Configurer
-	Valid bool
-	SM    string
-	ASM   string
-	API   string
+	Valid       bool
+	SM          string
+	ASM         string
+	API         string
+	AllowCycles bool
+	Flatten     bool
+	Mailboxes   []string
+	Dangling    string
+	FoldCase    bool
+	Concurrency int
+	Statics     []utils.StaticAlias
 }
 
 func (tc configTest) IsHistoricalOfficerValid(now, to time.Time) (bool, error) {
@@ -384,6 +392,34 @@ func (tc configTest) GetApiKey() string {
 	return tc.API
 }
 
+func (tc configTest) GetAllowCycles() bool {
+	return tc.AllowCycles
+}
+
+func (tc configTest) GetFlattenAliases() bool {
+	return tc.Flatten
+}
+
+func (tc configTest) GetLocalMailboxes() []string {
+	return tc.Mailboxes
+}
+
+func (tc configTest) GetDanglingPolicy() string {
+	return tc.Dangling
+}
+
+func (tc configTest) GetFoldCase() bool {
+	return tc.FoldCase
+}
+
+func (tc configTest) GetConcurrency() int {
+	return tc.Concurrency
+}
+
+func (tc configTest) GetStaticAliases() []utils.StaticAlias {
+	return tc.Statics
+}
+
 func TestGenerator_generateMailingListAliases(t *testing.T) {
 
 	var ury uryTest
@@ -398,7 +434,9 @@ func TestGenerator_generateMailingListAliases(t *testing.T) {
 		},
 	}
 
-	actual, err := generateMailingListAliases(ury)
+	report := &Report{}
+
+	actual, err := generateMailingListAliases(context.Background(), utils.ContextFetcher(ury), nil, report, 1)
 
 	if err != nil {
 		t.Error(err)
@@ -406,6 +444,25 @@ func TestGenerator_generateMailingListAliases(t *testing.T) {
 
 	assertAliases(actual, expected, t)
 
+	expectedIssues := []Issue{
+		{
+			Category: SkipMemberWithoutEmail,
+			Object:   ObjectMember,
+			ID:       5,
+			Message:  "Member receives email but has no email address, so gets nothing from list 'Test List 2'",
+		},
+		{
+			Category: SkipListWithoutMembers,
+			Object:   ObjectList,
+			ID:       3,
+			Message:  "List 'Empty Test List 3' (Empty test.list3) has no members",
+		},
+	}
+
+	if eq := reflect.DeepEqual(expectedIssues, report.Issues); !eq {
+		t.Errorf("expected issues %v, got %v", expectedIssues, report.Issues)
+	}
+
 }
 
 func TestGenerator_generateMiscAliases(t *testing.T) {
@@ -427,7 +484,7 @@ func TestGenerator_generateMiscAliases(t *testing.T) {
 		},
 	}
 
-	actual, err := generateMiscAliases(ury)
+	actual, err := generateMiscAliases(context.Background(), utils.ContextFetcher(ury), nil, nil)
 
 	if err != nil {
 		t.Error(err)
@@ -443,7 +500,7 @@ func TestGenerator_generateOfficerAliases1(t *testing.T) {
 		Valid: true,
 	}
 
-	actual, err := generateOfficerAliases(ury, config)
+	actual, err := generateOfficerAliases(context.Background(), utils.ContextFetcher(ury), config, nil, nil, 1)
 
 	expected := Aliases{
 		"boop": {
@@ -474,7 +531,7 @@ func TestGenerator_generateOfficerAliases2(t *testing.T) {
 		Valid: false,
 	}
 
-	actual, err := generateOfficerAliases(ury, config)
+	actual, err := generateOfficerAliases(context.Background(), utils.ContextFetcher(ury), config, nil, nil, 1)
 
 	expected := Aliases{
 		"boop": {
@@ -501,7 +558,9 @@ func TestGenerator_generateUserAliases(t *testing.T) {
 
 	var ury uryTest
 
-	actual, err := generateUserAliases(ury)
+	report := &Report{}
+
+	actual, err := generateUserAliases(context.Background(), utils.ContextFetcher(ury), nil, report)
 
 	expected := Aliases{
 		"chris.taylor": {
@@ -518,6 +577,9 @@ func TestGenerator_generateUserAliases(t *testing.T) {
 	}
 
 	assertAliases(actual, expected, t)
+	if report.Count(SkipMemberAliasBlank) != 2 {
+		t.Errorf("expected 2 blank member aliases to be reported, got %v", report.Issues)
+	}
 
 }
 
@@ -555,7 +617,31 @@ func TestGenerator_removeDuplicatesAndBlanks(t *testing.T) {
 		},
 	}
 
-	removeDuplicatesAndBlanks(&actual)
+	removeDuplicatesAndBlanks(&actual, false)
+
+	assertAliases(actual, expected, t)
+
+}
+
+func TestGenerator_removeDuplicatesAndBlanks_foldCase(t *testing.T) {
+
+	actual := Aliases{
+		"root": {
+			"Someone@example.com",
+			"someone@example.com",
+			"",
+			"another@example.com",
+		},
+	}
+
+	expected := Aliases{
+		"root": {
+			"Someone@example.com",
+			"another@example.com",
+		},
+	}
+
+	removeDuplicatesAndBlanks(&actual, true)
 
 	assertAliases(actual, expected, t)
 
@@ -631,7 +717,7 @@ func TestGenerator_addNonDottedAliases(t *testing.T) {
 		},
 	}
 
-	addNonDottedAliases(&actual)
+	addNonDottedAliases(&actual, nil)
 
 	assertAliases(actual, expected, t)
 
@@ -656,7 +742,7 @@ func TestGenerator_addManagementFallback1(t *testing.T) {
 		},
 	}
 
-	addManagementFallback(&actual, config)
+	addManagementFallback(&actual, config, nil)
 
 	assertAliases(actual, expected, t)
 
@@ -677,7 +763,7 @@ func TestGenerator_addManagementFallback2(t *testing.T) {
 		},
 	}
 
-	addManagementFallback(&actual, config)
+	addManagementFallback(&actual, config, nil)
 
 	assertAliases(actual, expected, t)
 
@@ -709,6 +795,13 @@ func TestGenerator_checkConfig_1(t *testing.T) {
 
 	assertErrorMessage(err, "No SM set in config", t)
 
+	tc.SM = "123"
+	tc.Dangling = "ignore"
+
+	err = checkConfig(tc)
+
+	assertErrorMessage(err, "Invalid DanglingPolicy 'ignore', it should be warn, drop or fail", t)
+
 }
 
 func assertErrorMessage(actual error, expected string, t *testing.T) {
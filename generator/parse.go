@@ -0,0 +1,255 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"io"
+	"os"
+	"strings"
+)
+
+// Special destination forms understood by exim's redirect router.
+// Failures and deferrals are followed by the message to give,
+// includes by the path of the file to include.
+const (
+	Blackhole = ":blackhole:"
+	Fail      = ":fail:"
+	Defer     = ":defer:"
+	Include   = ":include:"
+)
+
+// IsSpecialDestination returns whether a destination is one of the special forms,
+// a pipe to a command or a file, rather than an address or an alias.
+func IsSpecialDestination(d string) bool {
+	return d == Blackhole ||
+		strings.HasPrefix(d, Fail) ||
+		strings.HasPrefix(d, Defer) ||
+		strings.HasPrefix(d, Include) ||
+		strings.HasPrefix(d, "|") ||
+		strings.HasPrefix(d, "/")
+}
+
+// ParseAliases reads an exim aliases file, either written by alias-go or by hand.
+//
+// Lines starting with '#' are comments and lines starting with whitespace
+// continue the previous line. The alias name may be quoted and is followed
+// by an optional ':'. Destinations are separated by commas and may be quoted,
+// in which case they may contain commas and '\"'. The message following
+// :fail: or :defer: runs to the end of the entry.
+// As with exim's lsearch, only the first entry for an alias is used.
+func ParseAliases(r io.Reader) (Aliases, error) {
+	return ParseAliasesContext(context.Background(), r)
+}
+
+// ParseAliasesContext is ParseAliases, logging to the logger ctx carries.
+func ParseAliasesContext(ctx context.Context, r io.Reader) (Aliases, error) {
+	aliases := make(Aliases)
+	var entry string
+	var entryLine int
+	flush := func() error {
+		if entry == "" {
+			return nil
+		}
+		source, dests, err := parseEntry(entry)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", entryLine, err)
+		}
+		if _, exists := aliases[source]; exists {
+			utils.Logger(ctx).Warn("Ignoring a duplicate alias", utils.LogAlias, source, "line", entryLine)
+		} else {
+			aliases[source] = dests
+		}
+		entry = ""
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(text, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed != text {
+			if entry == "" {
+				return nil, fmt.Errorf("line %d: continuation line without an alias", line)
+			}
+			entry += "\n" + trimmed
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		entry = text
+		entryLine = line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// ParseAliasesFile reads the aliases file at path.
+func ParseAliasesFile(path string) (Aliases, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAliases(f)
+}
+
+// parseEntry splits an entry, with its continuation lines joined by newlines,
+// into the alias and its destinations.
+func parseEntry(entry string) (string, []string, error) {
+	var source, rest string
+	if strings.HasPrefix(entry, `"`) {
+		var err error
+		source, rest, err = unquote(entry)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		i := strings.IndexAny(entry, ": \t\n")
+		if i < 0 {
+			i = len(entry)
+		}
+		source, rest = entry[:i], entry[i:]
+	}
+	if source == "" {
+		return "", nil, fmt.Errorf("missing alias name")
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if strings.HasPrefix(rest, ":") && !isSpecialPrefix(rest) {
+		rest = rest[1:]
+	}
+	dests, err := parseDestinations(rest)
+	if err != nil {
+		return "", nil, fmt.Errorf("alias '%s': %s", source, err)
+	}
+	return source, dests, nil
+}
+
+func parseDestinations(data string) ([]string, error) {
+	dests := make([]string, 0)
+	for {
+		data = strings.TrimLeft(data, " \t\n,")
+		switch {
+		case data == "":
+			return dests, nil
+		case strings.HasPrefix(data, "#"):
+			// A comment runs to the end of its line
+			if i := strings.Index(data, "\n"); i >= 0 {
+				data = data[i:]
+			} else {
+				data = ""
+			}
+		case strings.HasPrefix(data, Fail), strings.HasPrefix(data, Defer):
+			i := strings.Index(data[1:], ":") + 2
+			// alias-go ends every entry with a comma, which is not part of the message
+			message := strings.TrimRight(strings.Join(strings.Fields(data[i:]), " "), ",")
+			if message == "" {
+				return append(dests, data[:i]), nil
+			}
+			return append(dests, data[:i]+" "+message), nil
+		case strings.HasPrefix(data, `"`):
+			d, rest, err := unquote(data)
+			if err != nil {
+				return nil, err
+			}
+			if rest != "" && !strings.ContainsAny(rest[:1], ", \t\n") {
+				// A quoted local part, so keep the address as it is written
+				i := strings.IndexAny(rest, ",\n")
+				if i < 0 {
+					i = len(rest)
+				}
+				d = strings.TrimSpace(data[:len(data)-len(rest)+i])
+				rest = rest[i:]
+			}
+			if d != "" {
+				dests = append(dests, d)
+			}
+			data = rest
+		default:
+			i := strings.IndexAny(data, ",\n")
+			if i < 0 {
+				i = len(data)
+			}
+			d := strings.TrimSpace(data[:i])
+			if strings.HasPrefix(d, Include) {
+				d = Include + strings.TrimSpace(d[len(Include):])
+			}
+			dests = append(dests, d)
+			data = data[i:]
+		}
+	}
+}
+
+func isSpecialPrefix(s string) bool {
+	return strings.HasPrefix(s, Blackhole) ||
+		strings.HasPrefix(s, Fail) ||
+		strings.HasPrefix(s, Defer) ||
+		strings.HasPrefix(s, Include)
+}
+
+// unquote reads a double quoted string from the start of s,
+// returning its contents and the remainder of s.
+func unquote(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 == len(s) {
+				break
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted string %s", s)
+}
+
+// quoteAlias quotes an alias name if it would otherwise not be read back as one.
+func quoteAlias(s string) string {
+	if s != "" && !strings.HasPrefix(s, "#") && !strings.ContainsAny(s, ":\",\n\t ") {
+		return s
+	}
+	return quote(s)
+}
+
+// quoteDestination quotes a destination if it would otherwise not be read back as one.
+// The message following :fail: or :defer: can't be quoted, so any line breaks
+// in it are replaced with spaces rather than being allowed to start a new alias.
+func quoteDestination(d string) string {
+	if strings.HasPrefix(d, Fail) || strings.HasPrefix(d, Defer) {
+		return lineBreaks.Replace(d)
+	}
+	if d != "" && !strings.HasPrefix(d, `"`) && !strings.HasPrefix(d, "#") && !strings.ContainsAny(d, ",\n\t ") {
+		return d
+	}
+	return quote(d)
+}
+
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,155 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerator_ParseAliases_roundTrip(t *testing.T) {
+
+	expected := Aliases{
+		"root": {
+			"testing",
+			"is",
+			"fun",
+		},
+		"not.root": {
+			"testing",
+			"is",
+			"exciting",
+		},
+		"with spaces": {
+			"|/usr/bin/vacation -a a,b",
+			"\"quoted\"",
+			":include:/etc/exim/extra",
+			":fail: No longer in use, sorry",
+		},
+	}
+
+	str := "# Generated: today\n" + aliasesToString(expected)
+
+	actual, err := ParseAliases(strings.NewReader(str))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertAliases(actual, expected, t)
+
+}
+
+func TestGenerator_aliasesToString_injection(t *testing.T) {
+
+	a := Aliases{
+		"old.society": {":fail: gone\nroot: evil@example.com"},
+		"busy":        {":defer: later\r\nroot: evil@example.com"},
+	}
+
+	str := aliasesToString(a)
+	if strings.Count(str, "\n") != 2 || strings.Contains(str, "\nroot:") {
+		t.Fatalf("Expected a line for each alias, got \n%s", str)
+	}
+
+	actual, err := ParseAliases(strings.NewReader(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Aliases{
+		"old.society": {":fail: gone root: evil@example.com"},
+		"busy":        {":defer: later root: evil@example.com"},
+	}
+	assertAliases(actual, expected, t)
+
+}
+
+func TestGenerator_ParseAliases_handWritten(t *testing.T) {
+
+	str := `# A hand maintained aliases file
+
+postmaster: root
+root:   someone@example.com,
+        # the backup admin
+        "someone else"@example.com,
+  another@example.com
+pipe: "|/usr/local/bin/ticket --queue support", archive
+nowhere :blackhole:
+old.team: :fail: This team no longer exists,
+  please contact computing
+later: :defer: Try again later
+more: :include: /etc/exim/more
+"quoted alias": a, b
+postmaster: ignored
+`
+
+	expected := Aliases{
+		"postmaster": {
+			"root",
+		},
+		"root": {
+			"someone@example.com",
+			"\"someone else\"@example.com",
+			"another@example.com",
+		},
+		"pipe": {
+			"|/usr/local/bin/ticket --queue support",
+			"archive",
+		},
+		"nowhere": {
+			":blackhole:",
+		},
+		"old.team": {
+			":fail: This team no longer exists, please contact computing",
+		},
+		"later": {
+			":defer: Try again later",
+		},
+		"more": {
+			":include:/etc/exim/more",
+		},
+		"quoted alias": {
+			"a",
+			"b",
+		},
+	}
+
+	actual, err := ParseAliases(strings.NewReader(str))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertAliases(actual, expected, t)
+
+}
+
+func TestGenerator_ParseAliases_errors(t *testing.T) {
+
+	_, err := ParseAliases(strings.NewReader("  continued: nothing\n"))
+
+	assertErrorMessage(err, "line 1: continuation line without an alias", t)
+
+	_, err = ParseAliases(strings.NewReader("ok: fine\nbroken: \"unterminated\n"))
+
+	assertErrorMessage(err, "line 2: alias 'broken': unterminated quoted string \"unterminated", t)
+
+	_, err = ParseAliases(strings.NewReader("ok: fine\n: nameless\n"))
+
+	assertErrorMessage(err, "line 2: missing alias name", t)
+
+}
+
+func TestGenerator_IsSpecialDestination(t *testing.T) {
+
+	for _, d := range []string{":blackhole:", ":fail: gone", ":defer: later", ":include:/a", "|/bin/cat", "/var/mail/x"} {
+		if !IsSpecialDestination(d) {
+			t.Errorf("'%s' should be special", d)
+		}
+	}
+
+	for _, d := range []string{"someone@example.com", "head.of.computing"} {
+		if IsSpecialDestination(d) {
+			t.Errorf("'%s' should not be special", d)
+		}
+	}
+
+}
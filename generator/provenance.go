@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"strings"
+	"time"
+)
+
+// The generators that can add a destination to an alias.
+const (
+	GeneratorMailingList = "mailing list"
+	GeneratorMisc        = "misc"
+	GeneratorOfficer     = "officer"
+	GeneratorUser        = "user"
+	GeneratorNonDotted   = "non-dotted"
+	GeneratorFallback    = "management fallback"
+	GeneratorFlatten     = "flattened"
+	GeneratorStatic      = "static"
+)
+
+// Origin records why a destination was added to an alias.
+// The MyRadio ids are zero when they do not apply.
+type Origin struct {
+	Generator string
+	Detail    string
+	ListID    int
+	MiscID    int
+	OfficerID int
+	TeamID    int
+	MemberID  int
+	// To is the end of the term of a historical officer.
+	To time.Time
+	// DestinationType is the type of a misc alias destination, such as 'officer' or 'list'.
+	DestinationType string
+}
+
+func (o Origin) String() string {
+	var ids []string
+	if o.ListID != 0 {
+		ids = append(ids, fmt.Sprintf("list id: %d", o.ListID))
+	}
+	if o.MiscID != 0 {
+		ids = append(ids, fmt.Sprintf("misc id: %d", o.MiscID))
+	}
+	if o.OfficerID != 0 {
+		ids = append(ids, fmt.Sprintf("officer id: %d", o.OfficerID))
+	}
+	if o.TeamID != 0 {
+		ids = append(ids, fmt.Sprintf("team id: %d", o.TeamID))
+	}
+	if o.MemberID != 0 {
+		ids = append(ids, fmt.Sprintf("member id: %d", o.MemberID))
+	}
+	if !o.To.IsZero() {
+		ids = append(ids, fmt.Sprintf("term ended: %s", o.To.Format("2006-01-02")))
+	}
+	str := o.Generator + ": " + o.Detail
+	if len(ids) > 0 {
+		str += " (" + strings.Join(ids, ", ") + ")"
+	}
+	return str
+}
+
+// logArgs returns the generator and MyRadio ids of o, as fields for a log record.
+func (o Origin) logArgs() []any {
+	args := []any{"generator", o.Generator}
+	for _, id := range []struct {
+		key string
+		id  int
+	}{
+		{utils.LogListID, o.ListID},
+		{utils.LogMiscID, o.MiscID},
+		{utils.LogOfficerID, o.OfficerID},
+		{utils.LogTeamID, o.TeamID},
+		{utils.LogMemberID, o.MemberID},
+	} {
+		if id.id != 0 {
+			args = append(args, id.key, id.id)
+		}
+	}
+	return args
+}
+
+// object returns the MyRadio object o is most specifically about, and its id.
+func (o Origin) object() (string, int) {
+	switch {
+	case o.MemberID != 0:
+		return ObjectMember, o.MemberID
+	case o.MiscID != 0:
+		return ObjectMiscAlias, o.MiscID
+	case o.ListID != 0:
+		return ObjectList, o.ListID
+	case o.OfficerID != 0:
+		return ObjectOfficer, o.OfficerID
+	case o.TeamID != 0:
+		return ObjectTeam, o.TeamID
+	case o.Generator == GeneratorUser:
+		return ObjectMemberAlias, 0
+	}
+	return o.Generator, 0
+}
+
+// Provenance holds the origins of every destination.
+// It is keyed by source and then by destination.
+type Provenance map[string]map[string][]Origin
+
+// Of returns the origins of a destination of a source.
+func (p Provenance) Of(source, dest string) []Origin {
+	return p[source][dest]
+}
+
+// add records an origin, a nil Provenance records nothing.
+func (p Provenance) add(source, dest string, o Origin) {
+	if p == nil {
+		return
+	}
+	if _, exists := p[source]; !exists {
+		p[source] = make(map[string][]Origin)
+	}
+	p[source][dest] = append(p[source][dest], o)
+}
+
+// mergeProvenance combines provenances, keeping the origins in the order given.
+func mergeProvenance(args ...Provenance) Provenance {
+	merged := make(Provenance)
+	for _, p := range args {
+		for s, dests := range p {
+			for d, origins := range dests {
+				for _, o := range origins {
+					merged.add(s, d, o)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// Counts are how many aliases and recipients a generator contributed to.
+type Counts struct {
+	Aliases    int
+	Recipients int
+}
+
+// CountByGenerator returns how many aliases each generator added destinations to,
+// and how many destinations it added, counting destinations from several generators
+// once for each of them.
+func (r *Result) CountByGenerator() map[string]Counts {
+	counts := make(map[string]Counts)
+	for s, ds := range r.Aliases {
+		contributed := make(map[string]bool)
+		for _, d := range ds {
+			seen := make(map[string]bool)
+			for _, o := range r.Provenance.Of(s, d) {
+				if seen[o.Generator] {
+					continue
+				}
+				seen[o.Generator] = true
+				c := counts[o.Generator]
+				c.Recipients++
+				if !contributed[o.Generator] {
+					contributed[o.Generator] = true
+					c.Aliases++
+				}
+				counts[o.Generator] = c
+			}
+		}
+	}
+	return counts
+}
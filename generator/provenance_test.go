@@ -0,0 +1,171 @@
+package generator
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenerator_Generate_provenance(t *testing.T) {
+
+	var ury uryTest
+	// 'chris.taylor' is an alias for 'christaylor', which loops back
+	var config = configTest{
+		SM:          "sm",
+		ASM:         "asm",
+		AllowCycles: true,
+	}
+
+	r, err := Generate(ury, config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertOrigins(r.Provenance.Of("test.list1", "test.member1"), []Origin{
+		{
+			Generator: GeneratorMailingList,
+			Detail:    "member of list 'Test List 1'",
+			ListID:    1,
+			MemberID:  1,
+		},
+	}, t)
+
+	assertOrigins(r.Provenance.Of("boop", "qwexgd@baz"), []Origin{
+		{
+			Generator: GeneratorOfficer,
+			Detail:    "head of team '', as 'No current officer, should add head of team' has no current holder",
+			OfficerID: 2,
+			TeamID:    2,
+			MemberID:  456,
+		},
+	}, t)
+
+	assertOrigins(r.Provenance.Of("testlist1", "test.list1"), []Origin{
+		{
+			Generator: GeneratorNonDotted,
+			Detail:    "non-dotted form of 'test.list1'",
+		},
+	}, t)
+
+	assertOrigins(r.Provenance.Of("sm", "asm"), []Origin{
+		{
+			Generator: GeneratorFallback,
+			Detail:    "there is no head of station, falling back to the assistant",
+		},
+	}, t)
+
+}
+
+func TestGenerator_Explain(t *testing.T) {
+
+	to, _ := time.Parse("2006/01/02", "2016/01/01")
+
+	r := Result{
+		Aliases: Aliases{
+			"headofcomputing": {
+				"head.of.computing",
+			},
+			"head.of.computing": {
+				"current@example.com",
+				"previous@example.com",
+			},
+		},
+		Provenance: Provenance{
+			"headofcomputing": {
+				"head.of.computing": {
+					{
+						Generator: GeneratorNonDotted,
+						Detail:    "non-dotted form of 'head.of.computing'",
+					},
+				},
+			},
+			"head.of.computing": {
+				"current@example.com": {
+					{
+						Generator: GeneratorOfficer,
+						Detail:    "current holder of 'Head of Computing'",
+						OfficerID: 26,
+						MemberID:  1,
+					},
+				},
+				"previous@example.com": {
+					{
+						Generator: GeneratorOfficer,
+						Detail:    "previous holder of 'Head of Computing', still within the stand down period",
+						OfficerID: 26,
+						MemberID:  2,
+						To:        to,
+					},
+				},
+			},
+		},
+	}
+
+	expected := "headofcomputing\n" +
+		"  head.of.computing\n" +
+		"    <- non-dotted: non-dotted form of 'head.of.computing'\n" +
+		"    current@example.com\n" +
+		"      <- officer: current holder of 'Head of Computing' (officer id: 26, member id: 1)\n" +
+		"    previous@example.com\n" +
+		"      <- officer: previous holder of 'Head of Computing', still within the stand down period " +
+		"(officer id: 26, member id: 2, term ended: 2016-01-01)\n"
+
+	var actual bytes.Buffer
+	err := r.Explain(&actual, "headofcomputing")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.String() != expected {
+		t.Errorf("expected \n%s, got \n%s", expected, actual.String())
+	}
+
+	err = r.Explain(&actual, "missing")
+
+	assertErrorMessage(err, "No alias 'missing'", t)
+
+}
+
+func assertOrigins(actual, expected []Origin, t *testing.T) {
+	if len(actual) != len(expected) {
+		t.Errorf("\n\nDifferent number of origins:\n\nExpected:\n\n%v\n\nGot\n\n%v", expected, actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("\n\nOrigins do not match:\n\nExpected:\n\n%v\n\nGot\n\n%v", expected[i], actual[i])
+		}
+	}
+}
+
+func TestGenerator_CountByGenerator(t *testing.T) {
+
+	r := &Result{
+		Aliases: Aliases{
+			"computing":       {"a@example.com", "b@example.com"},
+			"webmaster":       {"computing", "c@example.com"},
+			"head.of.station": {"d@example.com"},
+		},
+		Provenance: make(Provenance),
+	}
+	r.Provenance.add("computing", "a@example.com", Origin{Generator: GeneratorMailingList})
+	r.Provenance.add("computing", "b@example.com", Origin{Generator: GeneratorMailingList})
+	r.Provenance.add("computing", "b@example.com", Origin{Generator: GeneratorMisc})
+	r.Provenance.add("webmaster", "computing", Origin{Generator: GeneratorMisc})
+	r.Provenance.add("webmaster", "c@example.com", Origin{Generator: GeneratorMisc})
+	r.Provenance.add("webmaster", "c@example.com", Origin{Generator: GeneratorMisc, MiscID: 2})
+
+	expected := map[string]Counts{
+		GeneratorMailingList: {Aliases: 1, Recipients: 2},
+		GeneratorMisc:        {Aliases: 2, Recipients: 3},
+	}
+	actual := r.CountByGenerator()
+
+	if eq := reflect.DeepEqual(expected, actual); !eq {
+		t.Errorf("expected \n%v, got \n%v", expected, actual)
+	}
+
+}
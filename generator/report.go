@@ -0,0 +1,234 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The kinds of MyRadio object an issue can be about.
+const (
+	ObjectList        = "list"
+	ObjectMember      = "member"
+	ObjectOfficer     = "officer"
+	ObjectTeam        = "team"
+	ObjectMiscAlias   = "misc alias"
+	ObjectMemberAlias = "member alias"
+)
+
+// Issue is something MyRadio returned that couldn't be used as it was,
+// for the MyRadio admins to fix.
+type Issue struct {
+	// Category is why it couldn't be used, one of SkipReasons.
+	Category string `json:"category"`
+	// Object is the kind of MyRadio object at fault, such as ObjectList.
+	Object string `json:"object"`
+	// ID is the MyRadio id of the object, or zero if it doesn't have one.
+	ID      int    `json:"id,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report holds the issues found while generating.
+type Report struct {
+	Issues []Issue
+}
+
+// add records an issue, a nil Report records nothing.
+func (r *Report) add(category, object string, id int, format string, args ...interface{}) {
+	if r != nil {
+		r.Issues = append(r.Issues, Issue{
+			Category: category,
+			Object:   object,
+			ID:       id,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+}
+
+// Count returns the number of issues in category.
+func (r *Report) Count(category string) int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, i := range r.Issues {
+		if i.Category == category {
+			n++
+		}
+	}
+	return n
+}
+
+// mergeReports returns every issue in reports, sorted by category, object and id.
+func mergeReports(reports ...*Report) *Report {
+	merged := &Report{Issues: []Issue{}}
+	for _, r := range reports {
+		merged.Issues = append(merged.Issues, r.Issues...)
+	}
+	sort.SliceStable(merged.Issues, func(i, j int) bool {
+		a, b := merged.Issues[i], merged.Issues[j]
+		if a.Category != b.Category {
+			return categoryOrder(a.Category) < categoryOrder(b.Category)
+		}
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		return a.ID < b.ID
+	})
+	return merged
+}
+
+// categoryOrder returns where category comes in SkipReasons, so reports follow the same order.
+func categoryOrder(category string) int {
+	for i, c := range SkipReasons {
+		if c == category {
+			return i
+		}
+	}
+	return len(SkipReasons)
+}
+
+// categoryTitles are the headings of each category in a report.
+var categoryTitles = map[string]string{
+	SkipListWithoutAddress:  "Lists without an address",
+	SkipListWithoutMembers:  "Lists without members",
+	SkipMemberWithoutEmail:  "Members receiving email without an email address",
+	SkipMiscBlankSource:     "Misc aliases with a blank source",
+	SkipOfficerWithoutAlias: "Officers without an alias",
+	SkipMemberAliasBlank:    "Member aliases with a blank source or destination",
+	SkipInvalidAddress:      "Invalid addresses",
+	SkipTeamWithoutHead:     "Teams without a head",
+}
+
+// reportSection is the issues in one category of a report.
+type reportSection struct {
+	Category string
+	Title    string
+	Issues   []Issue
+}
+
+// sections groups the issues by category, in the order they are sorted in.
+func (r *Report) sections() []reportSection {
+	var sections []reportSection
+	for _, i := range r.Issues {
+		if len(sections) == 0 || sections[len(sections)-1].Category != i.Category {
+			title, ok := categoryTitles[i.Category]
+			if !ok {
+				title = i.Category
+			}
+			sections = append(sections, reportSection{Category: i.Category, Title: title})
+		}
+		sections[len(sections)-1].Issues = append(sections[len(sections)-1].Issues, i)
+	}
+	return sections
+}
+
+// The formats a report can be written in.
+const (
+	ReportMarkdown = "markdown"
+	ReportHTML     = "html"
+	ReportJSON     = "json"
+)
+
+// reportExtensions maps file extensions to the report format they suggest.
+var reportExtensions = map[string]string{
+	".md":       ReportMarkdown,
+	".markdown": ReportMarkdown,
+	".html":     ReportHTML,
+	".htm":      ReportHTML,
+	".json":     ReportJSON,
+}
+
+// ReportFormatFor returns format if it is given, otherwise the format suggested
+// by the extension of file, falling back to Markdown.
+func ReportFormatFor(file, format string) (string, error) {
+	switch format {
+	case ReportMarkdown, ReportHTML, ReportJSON:
+		return format, nil
+	case "":
+		if f, ok := reportExtensions[strings.ToLower(filepath.Ext(file))]; ok {
+			return f, nil
+		}
+		return ReportMarkdown, nil
+	}
+	return "", fmt.Errorf("Unknown report format '%s', it should be one of: %s, %s, %s", format, ReportHTML, ReportJSON, ReportMarkdown)
+}
+
+// Format returns the report in format, saying it was generated at generated.
+func (r *Report) Format(format string, generated time.Time) ([]byte, error) {
+	generated = generated.UTC()
+	switch format {
+	case ReportMarkdown:
+		return r.markdown(generated), nil
+	case ReportHTML:
+		var b bytes.Buffer
+		err := reportTemplate.Execute(&b, map[string]interface{}{
+			"Generated": generated.Format(time.RFC3339),
+			"Total":     len(r.Issues),
+			"Sections":  r.sections(),
+		})
+		return b.Bytes(), err
+	case ReportJSON:
+		counts := make(map[string]int)
+		for _, i := range r.Issues {
+			counts[i.Category]++
+		}
+		b, err := json.MarshalIndent(struct {
+			Generated time.Time      `json:"generated"`
+			Counts    map[string]int `json:"counts"`
+			Issues    []Issue        `json:"issues"`
+		}{generated, counts, append([]Issue{}, r.Issues...)}, "", "  ")
+		return append(b, '\n'), err
+	}
+	_, err := ReportFormatFor("", format)
+	return nil, err
+}
+
+// markdownEscaper stops messages breaking out of their table cell.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+func (r *Report) markdown(generated time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# MyRadio data quality report\n\n")
+	fmt.Fprintf(&b, "Generated %s, %d issues.\n", generated.Format(time.RFC3339), len(r.Issues))
+	for _, s := range r.sections() {
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", s.Title, len(s.Issues))
+		fmt.Fprintf(&b, "| Object | ID | Problem |\n")
+		fmt.Fprintf(&b, "|--------|----|---------|\n")
+		for _, i := range s.Issues {
+			id := ""
+			if i.ID != 0 {
+				id = fmt.Sprint(i.ID)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", i.Object, id, markdownEscaper.Replace(i.Message))
+		}
+	}
+	return b.Bytes()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MyRadio data quality report</title>
+</head>
+<body>
+<h1>MyRadio data quality report</h1>
+<p>Generated {{.Generated}}, {{.Total}} issues.</p>
+{{- range .Sections}}
+<h2 id="{{.Category}}">{{.Title}} ({{len .Issues}})</h2>
+<table>
+<tr><th>Object</th><th>ID</th><th>Problem</th></tr>
+{{- range .Issues}}
+<tr><td>{{.Object}}</td><td>{{if .ID}}{{.ID}}{{end}}</td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	a := &Report{}
+	a.add(SkipOfficerWithoutAlias, ObjectOfficer, 7, "Officer '%s' has no alias", "Treasurer")
+	a.add(SkipListWithoutAddress, ObjectList, 12, "List '%s' has no address", "Training | Tech")
+	b := &Report{}
+	b.add(SkipMemberAliasBlank, ObjectMemberAlias, 0, "Member alias has a blank source or destination: '' to '<x>'")
+	b.add(SkipListWithoutAddress, ObjectList, 3, "List '%s' has no address", "Sport")
+	return mergeReports(a, b)
+}
+
+func TestGenerator_Report(t *testing.T) {
+
+	r := testReport()
+
+	var categories []string
+	for _, i := range r.Issues {
+		categories = append(categories, i.Category)
+	}
+	expected := "list_without_address list_without_address officer_without_alias member_alias_blank"
+	if strings.Join(categories, " ") != expected {
+		t.Errorf("Expected issues sorted as '%s', got '%s'", expected, strings.Join(categories, " "))
+	}
+	if r.Issues[0].ID != 3 {
+		t.Errorf("Expected issues in a category sorted by id, got %v", r.Issues)
+	}
+	if r.Count(SkipListWithoutAddress) != 2 || r.Count(SkipTeamWithoutHead) != 0 {
+		t.Errorf("Expected counts of 2 and 0, got %d and %d", r.Count(SkipListWithoutAddress), r.Count(SkipTeamWithoutHead))
+	}
+	var nilReport *Report
+	nilReport.add(SkipListWithoutAddress, ObjectList, 1, "ignored")
+	if nilReport.Count(SkipListWithoutAddress) != 0 {
+		t.Error("Expected a nil report to record nothing")
+	}
+
+}
+
+func TestGenerator_Report_Format(t *testing.T) {
+
+	r := testReport()
+	generated := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	b, err := r.Format(ReportMarkdown, generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Generated 2026-10-17T09:00:00Z, 4 issues.\n",
+		"\n## Lists without an address (2)\n\n| Object | ID | Problem |\n|--------|----|---------|\n| list | 3 | List 'Sport' has no address |\n",
+		"| list | 12 | List 'Training \\| Tech' has no address |\n",
+		"| member alias |  | Member alias has a blank source or destination: '' to '<x>' |\n",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("Expected the Markdown report to contain '%s', got \n%s", expected, b)
+		}
+	}
+
+	b, err = r.Format(ReportHTML, generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<h2 id="officer_without_alias">Officers without an alias (1)</h2>`,
+		"<tr><td>officer</td><td>7</td><td>Officer &#39;Treasurer&#39; has no alias</td></tr>",
+		"<tr><td>member alias</td><td></td><td>Member alias has a blank source or destination: &#39;&#39; to &#39;&lt;x&gt;&#39;</td></tr>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("Expected the HTML report to contain '%s', got \n%s", expected, b)
+		}
+	}
+
+	b, err = r.Format(ReportJSON, generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Generated time.Time
+		Counts    map[string]int
+		Issues    []Issue
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Generated.Equal(generated) || decoded.Counts[SkipListWithoutAddress] != 2 || len(decoded.Issues) != 4 {
+		t.Errorf("Unexpected JSON report \n%s", b)
+	}
+
+	if _, err := r.Format("pdf", generated); err == nil {
+		t.Error("Expected an unknown format to fail")
+	}
+
+}
+
+func TestGenerator_ReportFormatFor(t *testing.T) {
+
+	for _, c := range []struct{ file, format, expected string }{
+		{"report.md", "", ReportMarkdown},
+		{"report.HTML", "", ReportHTML},
+		{"/var/www/report.json", "", ReportJSON},
+		{"report.txt", "", ReportMarkdown},
+		{"report.txt", ReportJSON, ReportJSON},
+	} {
+		actual, err := ReportFormatFor(c.file, c.format)
+		if err != nil || actual != c.expected {
+			t.Errorf("Expected '%s' for '%s' and '%s', got '%s' and '%v'", c.expected, c.file, c.format, actual, err)
+		}
+	}
+
+	_, err := ReportFormatFor("report.md", "pdf")
+	expected := "Unknown report format 'pdf', it should be one of: html, json, markdown"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error '%s', got '%v'", expected, err)
+	}
+
+}
@@ -0,0 +1,182 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CycleError is returned when following an alias leads back to itself.
+type CycleError struct {
+	// Path starts and ends with the same alias.
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "Alias loop: " + strings.Join(e.Path, " -> ")
+}
+
+// isAlias returns whether a destination is another alias to be followed.
+func (a Aliases) isAlias(d string) bool {
+	return len(a[d]) > 0 && !IsSpecialDestination(d)
+}
+
+// Expand returns the final recipients of an alias, following any destinations
+// that are themselves aliases. It returns a *CycleError if the alias loops.
+func (a Aliases) Expand(name string) ([]string, error) {
+	if _, exists := a[name]; !exists {
+		return nil, fmt.Errorf("No alias '%s'", name)
+	}
+	found := make(map[string]bool)
+	err := a.expand(name, []string{name}, found, make(map[string]bool), true)
+	if err != nil {
+		return nil, err
+	}
+	return sortedFound(found), nil
+}
+
+// expand adds the final recipients of source to found.
+// When strict is false a destination that loops back is treated as a
+// recipient, as exim would deliver it, rather than being an error.
+func (a Aliases) expand(source string, path []string, found, done map[string]bool, strict bool) error {
+	for _, d := range a[source] {
+		if !a.isAlias(d) {
+			found[d] = true
+			continue
+		}
+		if i := indexOf(path, d); i >= 0 {
+			if strict {
+				return &CycleError{Path: append(append([]string(nil), path[i:]...), d)}
+			}
+			found[d] = true
+			continue
+		}
+		if done[d] {
+			continue
+		}
+		if err := a.expand(d, append(path, d), found, done, strict); err != nil {
+			return err
+		}
+		done[d] = true
+	}
+	return nil
+}
+
+// Reverse returns the aliases that deliver to recipient, directly or through
+// other aliases, sorted. Recipients are compared ignoring case.
+// To look up many recipients, build a ReverseIndex once instead.
+func (a Aliases) Reverse(recipient string) []string {
+	return a.ReverseIndex().Lookup(recipient)
+}
+
+// ReverseIndex holds the aliases that deliver to each final recipient,
+// keyed by the recipient in lower case.
+type ReverseIndex map[string][]string
+
+// ReverseIndex expands every alias once, returning the index of which aliases
+// deliver to each recipient.
+func (a Aliases) ReverseIndex() ReverseIndex {
+	index := make(ReverseIndex)
+	for _, s := range sortedKeys(a) {
+		found := make(map[string]bool)
+		a.expand(s, []string{s}, found, make(map[string]bool), false)
+		added := make(map[string]bool)
+		for r := range found {
+			key := strings.ToLower(r)
+			if !added[key] {
+				added[key] = true
+				index[key] = append(index[key], s)
+			}
+		}
+	}
+	return index
+}
+
+// Lookup returns the aliases that deliver to recipient, sorted.
+// Recipients are compared ignoring case.
+func (r ReverseIndex) Lookup(recipient string) []string {
+	return append([]string{}, r[strings.ToLower(recipient)]...)
+}
+
+// FindCycles returns every loop in the aliases, each starting and ending with the same alias.
+func FindCycles(a Aliases) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var cycles [][]string
+	state := make(map[string]int)
+	var path []string
+	var visit func(s string)
+	visit = func(s string) {
+		state[s] = visiting
+		path = append(path, s)
+		dests := append([]string(nil), a[s]...)
+		sort.Strings(dests)
+		for _, d := range dests {
+			if !a.isAlias(d) {
+				continue
+			}
+			switch state[d] {
+			case visiting:
+				i := indexOf(path, d)
+				cycles = append(cycles, append(append([]string(nil), path[i:]...), d))
+			case unvisited:
+				visit(d)
+			}
+		}
+		path = path[:len(path)-1]
+		state[s] = visited
+	}
+	for _, s := range sortedKeys(a) {
+		if state[s] == unvisited {
+			visit(s)
+		}
+	}
+	return cycles
+}
+
+// flattenAliases replaces destinations that are aliases with their final recipients,
+// so every alias can be delivered without a further lookup.
+// Destinations that loop back are left in place.
+func flattenAliases(a Aliases, p Provenance) Aliases {
+	flat := make(Aliases)
+	for s, ds := range a {
+		flat[s] = make([]string, 0, len(ds))
+		for _, d := range ds {
+			if !a.isAlias(d) || d == s {
+				flat[s] = append(flat[s], d)
+				continue
+			}
+			found := make(map[string]bool)
+			a.expand(d, []string{s, d}, found, make(map[string]bool), false)
+			for _, r := range sortedFound(found) {
+				flat[s] = append(flat[s], r)
+				p.add(s, r, Origin{
+					Generator: GeneratorFlatten,
+					Detail:    fmt.Sprintf("recipient of '%s'", d),
+				})
+			}
+		}
+	}
+	return flat
+}
+
+func indexOf(ss []string, s string) int {
+	for i, v := range ss {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedFound(found map[string]bool) []string {
+	rs := make([]string, 0, len(found))
+	for r := range found {
+		rs = append(rs, r)
+	}
+	sort.Strings(rs)
+	return rs
+}
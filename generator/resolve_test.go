@@ -0,0 +1,223 @@
+package generator
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestGenerator_Expand(t *testing.T) {
+
+	a := Aliases{
+		"headofcomputing": {
+			"head.of.computing",
+		},
+		"head.of.computing": {
+			"someone@example.com",
+			"computing",
+		},
+		"computing": {
+			"someone@example.com",
+			"another@example.com",
+			"|/usr/bin/ticket",
+		},
+		"loop.a": {
+			"loop.b",
+		},
+		"loop.b": {
+			"outside@example.com",
+			"loop.a",
+		},
+		"self": {
+			"self",
+		},
+		"empty": {},
+		"to.empty": {
+			"empty",
+		},
+	}
+
+	actual, err := a.Expand("headofcomputing")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"another@example.com", "someone@example.com", "|/usr/bin/ticket"}
+
+	if eq := reflect.DeepEqual(expected, actual); !eq {
+		t.Errorf("expected \n%v, got \n%v", expected, actual)
+	}
+
+	actual, err = a.Expand("to.empty")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if eq := reflect.DeepEqual([]string{"empty"}, actual); !eq {
+		t.Errorf("Aliases without destinations should be recipients, got \n%v", actual)
+	}
+
+	_, err = a.Expand("loop.a")
+
+	assertErrorMessage(err, "Alias loop: loop.a -> loop.b -> loop.a", t)
+
+	_, err = a.Expand("self")
+
+	assertErrorMessage(err, "Alias loop: self -> self", t)
+
+	_, err = a.Expand("missing")
+
+	assertErrorMessage(err, "No alias 'missing'", t)
+
+}
+
+func TestGenerator_Reverse(t *testing.T) {
+
+	a := Aliases{
+		"headofcomputing": {
+			"head.of.computing",
+		},
+		"head.of.computing": {
+			"someone@example.com",
+		},
+		"computing": {
+			"Someone@example.com",
+			"another@example.com",
+		},
+		"loop.a": {
+			"loop.b",
+		},
+		"loop.b": {
+			"someone@example.com",
+			"loop.a",
+		},
+	}
+
+	expected := []string{"computing", "head.of.computing", "headofcomputing", "loop.a", "loop.b"}
+	actual := a.Reverse("someone@example.com")
+
+	if eq := reflect.DeepEqual(expected, actual); !eq {
+		t.Errorf("expected \n%v, got \n%v", expected, actual)
+	}
+
+	actual = a.Reverse("nobody@example.com")
+
+	if eq := reflect.DeepEqual([]string{}, actual); !eq {
+		t.Errorf("expected no aliases, got \n%v", actual)
+	}
+
+	index := a.ReverseIndex()
+	if actual := index.Lookup("SOMEONE@example.com"); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected the index to give \n%v, got \n%v", expected, actual)
+	}
+	if actual := index.Lookup("another@example.com"); !reflect.DeepEqual([]string{"computing"}, actual) {
+		t.Errorf("expected only computing, got \n%v", actual)
+	}
+
+}
+
+func TestGenerator_FindCycles(t *testing.T) {
+
+	a := Aliases{
+		"a":    {"b"},
+		"b":    {"c", "x@example.com"},
+		"c":    {"a"},
+		"self": {"self"},
+		"d":    {"a"},
+	}
+
+	expected := [][]string{
+		{"a", "b", "c", "a"},
+		{"self", "self"},
+	}
+
+	actual := FindCycles(a)
+
+	if eq := reflect.DeepEqual(expected, actual); !eq {
+		t.Errorf("expected \n%v, got \n%v", expected, actual)
+	}
+
+	if cycles := FindCycles(Aliases{"a": {"b"}, "b": {"c"}}); len(cycles) != 0 {
+		t.Errorf("expected no cycles, got \n%v", cycles)
+	}
+
+}
+
+func TestGenerator_flattenAliases(t *testing.T) {
+
+	a := Aliases{
+		"headofcomputing": {
+			"head.of.computing",
+		},
+		"head.of.computing": {
+			"someone@example.com",
+			"computing",
+		},
+		"computing": {
+			"another@example.com",
+		},
+		"loop.a": {
+			"loop.b",
+		},
+		"loop.b": {
+			"loop.a",
+			"outside@example.com",
+		},
+	}
+
+	p := make(Provenance)
+	actual := flattenAliases(a, p)
+
+	expected := Aliases{
+		"headofcomputing": {
+			"another@example.com",
+			"someone@example.com",
+		},
+		"head.of.computing": {
+			"someone@example.com",
+			"another@example.com",
+		},
+		"computing": {
+			"another@example.com",
+		},
+		"loop.a": {
+			"loop.a",
+			"outside@example.com",
+		},
+		"loop.b": {
+			"loop.b",
+			"outside@example.com",
+		},
+	}
+
+	assertAliases(actual, expected, t)
+
+	assertOrigins(p.Of("headofcomputing", "another@example.com"), []Origin{
+		{
+			Generator: GeneratorFlatten,
+			Detail:    "recipient of 'head.of.computing'",
+		},
+	}, t)
+
+}
+
+func TestGenerator_checkCycles(t *testing.T) {
+
+	a := Aliases{
+		"a": {"b"},
+		"b": {"a"},
+	}
+
+	err := checkCycles(slog.Default(), a, configTest{})
+
+	assertErrorMessage(err, "Found 1 alias loop(s): a -> b -> a", t)
+
+	err = checkCycles(slog.Default(), a, configTest{AllowCycles: true})
+
+	if err != nil {
+		t.Errorf("Expected nil, got '%s'", err.Error())
+	}
+
+}
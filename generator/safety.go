@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"strings"
+)
+
+// CheckSafety checks that replacing the old aliases with the new ones
+// stays within the limits, returning an error naming every limit breached.
+func CheckSafety(old, new Aliases, l utils.SafetyLimits) error {
+	var breaches []string
+	d := DiffAliases(old, new)
+	if l.MaxRemovedPercent > 0 {
+		total := 0
+		for _, ds := range old {
+			if len(ds) > 0 {
+				total++
+			}
+		}
+		if total > 0 {
+			percent := float64(len(d.Removed)) / float64(total) * 100
+			if percent > l.MaxRemovedPercent {
+				breaches = append(breaches, fmt.Sprintf("%d of %d aliases (%.1f%%) would be removed, "+
+					"more than MaxRemovedPercent of %g%%", len(d.Removed), total, percent, l.MaxRemovedPercent))
+			}
+		}
+	}
+	if l.MaxRemovedRecipients > 0 {
+		if removed := d.RemovedRecipients(); removed > l.MaxRemovedRecipients {
+			breaches = append(breaches, fmt.Sprintf("%d recipients would be removed, "+
+				"more than MaxRemovedRecipients of %d", removed, l.MaxRemovedRecipients))
+		}
+	}
+	for _, r := range l.RequiredAliases {
+		if len(new[r]) == 0 {
+			breaches = append(breaches, fmt.Sprintf("required alias '%s' would be missing", r))
+		}
+	}
+	if len(breaches) > 0 {
+		return errors.New("Refusing to replace the aliases file: " + strings.Join(breaches, "; "))
+	}
+	return nil
+}
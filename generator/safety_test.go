@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"testing"
+)
+
+func TestGenerator_CheckSafety(t *testing.T) {
+
+	old := Aliases{
+		"station.manager": {"sm@example.com"},
+		"computing":       {"a", "b", "c"},
+		"events":          {"d"},
+		"news":            {"e"},
+	}
+
+	limits := utils.SafetyLimits{
+		MaxRemovedPercent:    30,
+		MaxRemovedRecipients: 2,
+		RequiredAliases:      []string{"station.manager"},
+	}
+
+	err := CheckSafety(old, Aliases{
+		"station.manager": {"sm@example.com"},
+		"computing":       {"a", "b"},
+		"events":          {"d"},
+	}, limits)
+
+	if err != nil {
+		t.Errorf("Expected nil, got '%s'", err.Error())
+	}
+
+	err = CheckSafety(old, Aliases{
+		"station.manager": {"sm@example.com"},
+		"computing":       {"a", "b", "c"},
+	}, limits)
+
+	assertErrorMessage(err, "Refusing to replace the aliases file: "+
+		"2 of 4 aliases (50.0%) would be removed, more than MaxRemovedPercent of 30%", t)
+
+	err = CheckSafety(old, Aliases{
+		"computing": {"a"},
+		"events":    {"d"},
+		"news":      {"e"},
+	}, limits)
+
+	assertErrorMessage(err, "Refusing to replace the aliases file: "+
+		"3 recipients would be removed, more than MaxRemovedRecipients of 2; "+
+		"required alias 'station.manager' would be missing", t)
+
+	err = CheckSafety(old, Aliases{}, utils.SafetyLimits{})
+
+	if err != nil {
+		t.Errorf("Expected no limits to be checked, got '%s'", err.Error())
+	}
+
+}
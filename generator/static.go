@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"log/slog"
+	"strings"
+)
+
+// addStaticAliases merges the aliases given in the config into a, after everything
+// generated from MyRadio, so they take precedence over it.
+// A static alias in replace mode throws away what was generated for its source,
+// then the destinations of every static alias for a source are added in the order
+// they are given, so two static aliases for the same source both apply.
+// A dotted source gets a non-dotted form pointing at it, as generated aliases do,
+// unless that form is the source of a static alias in replace mode.
+// Invalid destinations are logged and left out, but not reported, as they are
+// problems with the config rather than MyRadio.
+func addStaticAliases(l *slog.Logger, a *Aliases, statics []utils.StaticAlias, p Provenance) {
+	replaced := make(map[string]bool)
+	for _, s := range statics {
+		if s.Mode != utils.StaticReplace {
+			continue
+		}
+		replaced[s.Source] = true
+		if _, exists := (*a)[s.Source]; exists {
+			l.Info("Replacing a generated alias with a static one", utils.LogAlias, s.Source)
+		}
+		delete(*a, s.Source)
+		delete(p, s.Source)
+	}
+	for _, s := range statics {
+		o := Origin{Generator: GeneratorStatic, Detail: fmt.Sprintf("static alias in the config (%s)", s.Mode)}
+		if s.Comment != "" {
+			o.Detail += ": " + s.Comment
+		}
+		if _, exists := (*a)[s.Source]; !exists {
+			(*a)[s.Source] = []string{}
+		}
+		for _, d := range s.Destinations {
+			if d, ok := checkAddress(l, nil, d, s.Source, o); ok {
+				(*a)[s.Source] = append((*a)[s.Source], d)
+				p.add(s.Source, d, o)
+			}
+		}
+		nd := strings.Replace(s.Source, ".", "", -1)
+		if nd != s.Source && !replaced[nd] && indexOf((*a)[nd], s.Source) < 0 {
+			(*a)[nd] = append((*a)[nd], s.Source)
+			p.add(nd, s.Source, nonDottedOrigin(s.Source))
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"log/slog"
+	"testing"
+)
+
+func TestGenerator_addStaticAliases(t *testing.T) {
+
+	actual := Aliases{
+		"computing":         {"member.one"},
+		"head.of.computing": {"member.two"},
+		"headofcomputing":   {"head.of.computing"},
+	}
+	p := make(Provenance)
+	p.add("headofcomputing", "head.of.computing", nonDottedOrigin("head.of.computing"))
+	p.add("head.of.computing", "member.two", Origin{Generator: GeneratorOfficer, OfficerID: 1})
+
+	statics := []utils.StaticAlias{
+		{Source: "postmaster", Destinations: []string{"root"}, Mode: utils.StaticAppend, Comment: "required by RFC 5321"},
+		{Source: "computing", Destinations: []string{"root", "not an address@"}, Mode: utils.StaticAppend},
+		{Source: "head.of.computing", Destinations: []string{"computing@example.org"}, Mode: utils.StaticReplace},
+		{Source: "head.of.computing", Destinations: []string{"member.three"}, Mode: utils.StaticAppend},
+		{Source: "events.team", Destinations: []string{"events@example.org"}, Mode: utils.StaticAppend},
+		{Source: "host.master", Destinations: []string{"root"}, Mode: utils.StaticAppend},
+		{Source: "hostmaster", Destinations: []string{"sysadmin@example.org"}, Mode: utils.StaticReplace},
+	}
+
+	expected := Aliases{
+		"postmaster":        {"root"},
+		"computing":         {"member.one", "root"},
+		"head.of.computing": {"computing@example.org", "member.three"},
+		"headofcomputing":   {"head.of.computing"},
+		"events.team":       {"events@example.org"},
+		"eventsteam":        {"events.team"},
+		"host.master":       {"root"},
+		"hostmaster":        {"sysadmin@example.org"},
+	}
+
+	addStaticAliases(slog.Default(), &actual, statics, p)
+
+	assertAliases(actual, expected, t)
+
+	if _, exists := p["head.of.computing"]["member.two"]; exists {
+		t.Error("Expected the provenance of the replaced destinations to be removed")
+	}
+	if o := p["eventsteam"]["events.team"]; len(o) != 1 || o[0].Generator != GeneratorNonDotted {
+		t.Errorf("Expected eventsteam to be the non-dotted form of events.team, got %v", o)
+	}
+	if o := p["headofcomputing"]["head.of.computing"]; len(o) != 1 {
+		t.Errorf("Expected the existing non-dotted form not to be added again, got %v", o)
+	}
+	o := p["postmaster"]["root"]
+	if len(o) != 1 || o[0].Generator != GeneratorStatic || o[0].Detail != "static alias in the config (append): required by RFC 5321" {
+		t.Errorf("Expected postmaster's origin to be the static alias, got %v", o)
+	}
+
+}
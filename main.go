@@ -1,26 +1,62 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/UniversityRadioYork/alias-go/generator"
 	"github.com/UniversityRadioYork/alias-go/utils"
 	"github.com/urfave/cli"
-	"os"
-	"log"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	// Interrupting or terminating cancels any generation
+	// in progress, leaving the aliases file alone
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	newApp(ctx).Run(os.Args)
+}
+
+// newApp returns the command line app, which gives up
+// on any generation in progress once ctx is done.
+func newApp(ctx context.Context) *cli.App {
 
 	var configfilepath string
 	var outfile string
 	var writeexample string
 	var verbose bool
+	var debug bool
+	var quiet bool
+	var logformat string
+	var logfile string
+	var logcloser io.Closer
+	var force bool
+	var format string
+	var timeout time.Duration
+	var frombundle string
+	var bundle string
+	var interval time.Duration
+	var listen string
+	var report string
+	var reportformat string
+	var config utils.Config
+	// configerr is what is wrong with the config, for config check and config show to report
+	var configerr error
 
 	app := cli.NewApp()
 	app.Name = "alias-go"
 	app.HideVersion = true
 	app.Usage = "Generates mailing lists"
+	app.ErrWriter = os.Stderr
 	app.Authors = []cli.Author{
 		cli.Author{
 			Name:  "Chris Taylor",
@@ -40,20 +76,99 @@ func main() {
 			Value:       "aliases",
 			Destination: &outfile,
 		},
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "Write aliases in `FORMAT`, overriding the config (default: \"exim\")",
+			Destination: &format,
+		},
 		cli.StringFlag{
 			Name:        "example-config, example, e",
 			Usage:       "Write an example config to `FILE`",
 			Destination: &writeexample,
 		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Give up on MyRadio after `DURATION`, or 0 to wait forever",
+			Value:       5 * time.Minute,
+			Destination: &timeout,
+		},
+		cli.StringFlag{
+			Name:        "from-bundle",
+			Usage:       "Generate from the bundle in `FILE` rather than MyRadio",
+			Destination: &frombundle,
+		},
+		cli.StringFlag{
+			Name:        "report",
+			Usage:       "Write a report of everything MyRadio returned that couldn't be used to `FILE`",
+			Destination: &report,
+		},
+		cli.StringFlag{
+			Name:        "report-format",
+			Usage:       "Write the report in `FORMAT`, markdown, html or json (default: from the report's extension)",
+			Destination: &reportformat,
+		},
+		cli.BoolFlag{
+			Name:        "force, f",
+			Usage:       "Replace the aliases file even if it breaches the safety limits",
+			Destination: &force,
+		},
 		cli.BoolFlag{
 			Name:        "verbose, v",
-			Usage:       "Output additional information to stdout",
+			Usage:       "Log what alias-go is doing as well as warnings",
 			Destination: &verbose,
 		},
+		cli.BoolFlag{
+			Name:        "vv",
+			Usage:       "Log everything, including every record skipped",
+			Destination: &debug,
+		},
+		cli.BoolFlag{
+			Name:        "quiet, q",
+			Usage:       "Only log errors",
+			Destination: &quiet,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Usage:       "Log as `FORMAT`, text or json",
+			Value:       utils.LogFormatText,
+			Destination: &logformat,
+		},
+		cli.StringFlag{
+			Name:        "log-file",
+			Usage:       "Append the log to `FILE` rather than writing it to stderr",
+			Destination: &logfile,
+		},
 	}
 
 	// Before the application runs, let's just do some validation
 	app.Before = func(c *cli.Context) error {
+		level := slog.LevelWarn
+		switch {
+		case quiet && (verbose || debug):
+			return cli.NewExitError("--quiet can't be used with --verbose or --vv", 1)
+		case quiet:
+			level = slog.LevelError
+		case debug:
+			level = slog.LevelDebug
+		case verbose:
+			level = slog.LevelInfo
+		}
+		w := c.App.ErrWriter
+		if logfile != "" {
+			f, err := os.OpenFile(logfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+			if err != nil {
+				return cli.NewExitError(fmt.Sprintf("Unable to open the log file: %s", err), 1)
+			}
+			w, logcloser = f, f
+		}
+		logger, err := utils.NewLogger(w, logformat, level)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		// Anything logging without a logger of its own goes to the same place
+		slog.SetDefault(logger)
+		ctx = utils.WithLogger(ctx, logger)
+
 		if "" == writeexample {
 			if "" == configfilepath {
 				return cli.NewExitError("Config file is required", 1)
@@ -61,15 +176,219 @@ func main() {
 			if _, err := os.Stat(configfilepath); os.IsNotExist(err) {
 				return cli.NewExitError("Invalid config file", 1)
 			}
-		}
-		if !verbose {
-			log.SetOutput(ioutil.Discard)
+			var err error
+			config, configerr = loadConfig(configfilepath)
+			if configerr != nil {
+				// The config commands report what is wrong themselves
+				if c.Args().First() == "config" {
+					return nil
+				}
+				return cli.NewExitError(configerr.Error(), 1)
+			}
+			if "" == format {
+				format = config.GetFormat()
+			}
+			if _, err := generator.FormatterFor(format); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			if reportformat, err = generator.ReportFormatFor(report, reportformat); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
 		}
 		return nil
 	}
 
+	// newDaemon returns a daemon for the aliases file and config given on the command line
+	newDaemon := func(c *cli.Context) *daemon {
+		d := &daemon{
+			configfile:   configfilepath,
+			outfile:      outfile,
+			force:        force,
+			timeout:      timeout,
+			interval:     interval,
+			config:       config,
+			metrics:      newRunMetrics(),
+			report:       report,
+			reportFormat: reportformat,
+		}
+		if c.GlobalIsSet("format") {
+			d.format = format
+		}
+		return d
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:      "explain",
+			Usage:     "Explain why each recipient of an alias receives its mail",
+			ArgsUsage: "ALIAS",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return cli.NewExitError("Exactly one alias to explain is required", 1)
+				}
+				result, _, err := generate(ctx, config, timeout, frombundle, nil)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				err = result.Explain(c.App.Writer, c.Args().First())
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "diff",
+			Usage: "Compare generated aliases with the aliases file, exiting with 1 if they differ",
+			Action: func(c *cli.Context) error {
+				// Like diff(1), differences exit with 1 and trouble with 2
+				result, _, err := generate(ctx, config, timeout, frombundle, nil)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 2)
+				}
+				current, err := readAliases(ctx, outfile, format)
+				if os.IsNotExist(err) {
+					utils.Logger(ctx).Info("No aliases file, treating it as empty", utils.LogFile, outfile)
+					current = generator.Aliases{}
+				} else if err != nil {
+					return cli.NewExitError(err.Error(), 2)
+				}
+				d := generator.DiffAliases(current, result.Aliases)
+				if d.Empty() {
+					return nil
+				}
+				_, err = d.WriteTo(c.App.Writer)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 2)
+				}
+				return cli.NewExitError("", 1)
+			},
+		},
+		{
+			Name:  "fetch",
+			Usage: "Save everything fetched from MyRadio to a bundle, to generate from with --from-bundle",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "bundle, b",
+					Usage:       "Write the bundle to `FILE` (required)",
+					Destination: &bundle,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if bundle == "" {
+					return cli.NewExitError("A file to write the bundle to is required", 1)
+				}
+				err := fetchBundle(ctx, config, timeout, bundle)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "daemon",
+			Usage: "Regenerate the aliases on an interval, only replacing the aliases file when they change",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:        "interval",
+					Usage:       "Regenerate every `DURATION`, overriding the config (default: 15m0s)",
+					Destination: &interval,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if frombundle != "" {
+					return cli.NewExitError("The daemon can't generate from a bundle", 1)
+				}
+				err := runDaemon(ctx, newDaemon(c))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "serve",
+			Usage: "Run the daemon, serving the aliases from its last good run over HTTP",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:        "interval",
+					Usage:       "Regenerate every `DURATION`, overriding the config (default: 15m0s)",
+					Destination: &interval,
+				},
+				cli.StringFlag{
+					Name:        "listen",
+					Usage:       "Listen on `ADDRESS`, overriding the config (default: \"127.0.0.1:8025\")",
+					Destination: &listen,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if frombundle != "" {
+					return cli.NewExitError("The daemon can't generate from a bundle", 1)
+				}
+				opts := config.GetServeOptions()
+				if listen != "" {
+					opts.Listen = listen
+				}
+				err := serve(ctx, newDaemon(c), opts)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "rollback",
+			Usage: "Replace the aliases file with its most recent backup",
+			Action: func(c *cli.Context) error {
+				err := utils.RollbackAliasesFile(outfile)
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "Check the config or show it as alias-go uses it",
+			Subcommands: []cli.Command{
+				{
+					Name:  "check",
+					Usage: "Check the config for unknown keys and invalid values, naming the line of each",
+					Action: func(c *cli.Context) error {
+						if configerr != nil {
+							return cli.NewExitError(configerr.Error(), 1)
+						}
+						fmt.Fprintf(c.App.Writer, "%s is valid\n", configfilepath)
+						return nil
+					},
+				},
+				{
+					Name:  "show",
+					Usage: "Print the config with the defaults filled in and secrets redacted",
+					Action: func(c *cli.Context) error {
+						if configerr != nil {
+							return cli.NewExitError(configerr.Error(), 1)
+						}
+						effective := format
+						if effective == "" {
+							effective = generator.DefaultFormat
+						}
+						if err := config.WriteEffective(c.App.Writer, effective); err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+						return nil
+					},
+				},
+			},
+		},
+	}
+
 	app.After = func(c *cli.Context) error {
-		fmt.Fprintln(c.App.Writer, "All done!")
+		// stdout is left to commands such as config show and explain, whose output is data
+		utils.Logger(ctx).Info("All done")
+		if logcloser != nil {
+			return logcloser.Close()
+		}
 		return nil
 	}
 
@@ -81,19 +400,22 @@ func main() {
 				cli.NewExitError(err.Error(), 1)
 			}
 		} else {
-			config, err := utils.NewConfigFromFile(configfilepath)
-			if err != nil {
-				return cli.NewExitError(err.Error(), 1)
+			m := newRunMetrics()
+			start := time.Now()
+			result, snapshot, err := generate(ctx, config, timeout, frombundle, m)
+			if err == nil {
+				if rerr := writeReport(report, reportformat, result); rerr != nil {
+					utils.Logger(ctx).Warn("Unable to write the report", utils.LogFile, report, utils.LogError, rerr)
+				}
+				err = writeAliases(ctx, config, result, outfile, format, force)
 			}
-			ury, err := utils.NewURY(config.GetApiKey())
-			if err != nil {
-				return cli.NewExitError(err.Error(), 1)
+			if err == nil {
+				saveSnapshot(ctx, config, snapshot)
 			}
-			aliases, err := generator.GenerateAliases(ury, config)
-			if err != nil {
-				return cli.NewExitError(err.Error(), 1)
+			m.observeRun(time.Since(start), result, err, outfile)
+			if merr := m.writeFile(config.GetMetricsFile()); merr != nil {
+				utils.Logger(ctx).Warn("Unable to write the metrics file", utils.LogFile, config.GetMetricsFile(), utils.LogError, merr)
 			}
-			err = utils.WriteAliasesToFile(aliases, outfile)
 			if err != nil {
 				return cli.NewExitError(err.Error(), 1)
 			}
@@ -101,5 +423,262 @@ func main() {
 		return nil
 	}
 
-	app.Run(os.Args)
+	return app
+}
+
+// loadConfig loads the config file, checking the format it gives too,
+// which is returned among any other ConfigErrors.
+func loadConfig(file string) (utils.Config, error) {
+	config, err := utils.NewConfigFromFile(file)
+	var errs utils.ConfigErrors
+	if err != nil && !errors.As(err, &errs) {
+		return config, err
+	}
+	if config.GetFormat() != "" {
+		if _, ferr := generator.FormatterFor(config.GetFormat()); ferr != nil {
+			errs = append(errs, &utils.ConfigError{File: file, Line: config.Line("Format"), Key: "Format", Message: ferr.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return config, errs
+	}
+	return config, nil
+}
+
+// writeReport writes the report of what result skipped to file in format, if file isn't empty.
+func writeReport(file, format string, result *generator.Result) error {
+	if file == "" {
+		return nil
+	}
+	b, err := result.Report.Format(format, time.Now())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+// newFetcher returns a fetcher for MyRadio which retries failed calls,
+// recording every attempt in m.
+func newFetcher(config utils.Config, m *runMetrics) (utils.URYFetcher, error) {
+	var ury utils.URY
+	var err error
+	if config.GetApiBaseURL() != "" {
+		ury, err = utils.NewURYForServer(config.GetApiKey(), config.GetApiBaseURL())
+	} else {
+		ury, err = utils.NewURY(config.GetApiKey())
+	}
+	if err != nil {
+		return nil, err
+	}
+	policy, err := config.GetRetryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		return utils.NewRetryFetcher(utils.NewObservedFetcher(ury, m.observeCall), policy), nil
+	}
+	return utils.NewRetryFetcher(ury, policy), nil
+}
+
+// withTimeout returns ctx with the timeout, if it isn't 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// contextError explains why ctx ended err, if it did.
+func contextError(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("Timed out after %s waiting for MyRadio, the aliases file was left untouched", timeout)
+	}
+	if errors.Is(err, context.Canceled) {
+		return errors.New("Interrupted, the aliases file was left untouched")
+	}
+	return err
+}
+
+// generate generates the aliases from MyRadio, giving up after timeout if
+// it isn't 0. If MyRadio can't be reached the last snapshot is used instead,
+// otherwise the responses are returned as a snapshot for saveSnapshot once
+// the aliases have been written, so only runs that succeed replace it.
+// If bundle isn't empty the aliases are generated from that bundle instead.
+// Calls to MyRadio are recorded in m.
+func generate(ctx context.Context, config utils.Config, timeout time.Duration, bundle string, m *runMetrics) (*generator.Result, *utils.Snapshot, error) {
+	if bundle != "" {
+		f, err := utils.NewFileFetcher(bundle)
+		if err != nil {
+			return nil, nil, err
+		}
+		utils.Logger(ctx).Info("Generating from a bundle", utils.LogFile, bundle, "taken", f.Taken())
+		result, err := generator.Generate(f, config)
+		return result, nil, err
+	}
+	ury, err := newFetcher(config, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	opts, err := config.GetSnapshotOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	var last *utils.Snapshot
+	if opts.File != "" {
+		last, err = utils.ReadSnapshotFile(opts.File)
+		if err != nil && !os.IsNotExist(err) {
+			utils.Logger(ctx).Warn("Unable to read the snapshot, carrying on without it", utils.LogFile, opts.File, utils.LogError, err)
+		}
+	}
+	fetcher := utils.NewSnapshotFetcher(ury, last, opts.MaxAge)
+	result, err := generator.GenerateContext(ctx, fetcher, config)
+	if err != nil {
+		return nil, nil, contextError(err, timeout)
+	}
+	if !result.SnapshotTaken.IsZero() {
+		utils.Logger(ctx).Warn("MyRadio was unreachable, the aliases were generated from the snapshot",
+			utils.LogFile, opts.File, "taken", result.SnapshotTaken.Format(time.RFC3339))
+		return result, nil, nil
+	}
+	return result, fetcher.Recorded(), nil
+}
+
+// saveSnapshot replaces the snapshot in the config's SnapshotFile with s,
+// if both are set. Failing to is logged rather than failing the run.
+func saveSnapshot(ctx context.Context, config utils.Config, s *utils.Snapshot) {
+	opts, err := config.GetSnapshotOptions()
+	if err != nil || opts.File == "" || s == nil {
+		return
+	}
+	if err := utils.WriteSnapshotFile(s, opts.File); err != nil {
+		utils.Logger(ctx).Error("Unable to save the snapshot", utils.LogFile, opts.File, utils.LogError, err)
+	}
+}
+
+// fetchBundle saves everything fetched from MyRadio to file,
+// giving up after timeout if it isn't 0.
+func fetchBundle(ctx context.Context, config utils.Config, timeout time.Duration, file string) error {
+	ury, err := newFetcher(config, nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	b, err := generator.FetchBundle(ctx, utils.ContextFetcher(ury), config.GetConcurrency())
+	if err != nil {
+		return contextError(err, timeout)
+	}
+	return utils.WriteBundleFile(b, file)
+}
+
+// writeAliases replaces the aliases file with the generated aliases,
+// unless doing so would breach the safety limits and force is not set.
+// Nothing is written once ctx is done.
+func writeAliases(ctx context.Context, config utils.Config, result *generator.Result, outfile, format string, force bool) error {
+	formatter, err := generator.FormatterFor(format)
+	if err != nil {
+		return err
+	}
+	opts, err := config.GetWriteOptions()
+	if err != nil {
+		return err
+	}
+	hooks, err := config.GetHooks()
+	if err != nil {
+		return err
+	}
+	existed, readable := true, true
+	raw, err := ioutil.ReadFile(outfile)
+	var current generator.Aliases
+	if err == nil {
+		current, err = formatter.Parse(ctx, bytes.NewReader(raw))
+	}
+	if os.IsNotExist(err) {
+		existed = false
+		current = generator.Aliases{}
+	} else if err != nil {
+		if !force {
+			return fmt.Errorf("Unable to check the safety limits against '%s': %s", outfile, err)
+		}
+		utils.Logger(ctx).Warn("Unable to read the aliases file, forcing the write anyway", utils.LogFile, outfile, utils.LogError, err)
+		readable = false
+		current = generator.Aliases{}
+	}
+	err = generator.CheckSafety(current, result.Aliases, config.GetSafetyLimits())
+	if err != nil {
+		if !force {
+			return fmt.Errorf("%s (use --force to write anyway)", err)
+		}
+		utils.Logger(ctx).Warn("Forcing the write", utils.LogError, err)
+	}
+	header := fmt.Sprintf("Generated: %s", time.Now())
+	if !result.SnapshotTaken.IsZero() {
+		header += fmt.Sprintf(" from the snapshot of MyRadio taken %s, as MyRadio was unreachable", result.SnapshotTaken)
+	}
+	b, err := formatter.Format(ctx, result.Aliases, header)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return errors.New("Interrupted, the aliases file was left untouched")
+	}
+	// Nothing is written when the file already holds these aliases in this format,
+	// ignoring its header, so unchanged runs don't fill the backups with copies of it
+	body, err := formatter.Format(ctx, result.Aliases, "")
+	if err != nil {
+		return err
+	}
+	diff := generator.DiffAliases(current, result.Aliases)
+	if existed && readable && diff.Empty() && bytes.HasSuffix(raw, body) {
+		utils.Logger(ctx).Info("The aliases haven't changed, leaving the file untouched", utils.LogFile, outfile)
+		return nil
+	}
+	env := utils.HookEnv{
+		Path:              outfile,
+		Format:            format,
+		Aliases:           len(result.Aliases),
+		Added:             len(diff.Added),
+		Removed:           len(diff.Removed),
+		Changed:           len(diff.Changed),
+		RecipientsAdded:   diff.AddedRecipients(),
+		RecipientsRemoved: diff.RemovedRecipients(),
+	}
+	if err := utils.RunHook(ctx, "pre-write", hooks.PreWrite, hooks.Timeout, env); err != nil {
+		return fmt.Errorf("%s, the aliases file was left untouched", err)
+	}
+	if hooks.RollbackOnFailure && hooks.PostWrite != "" && opts.Backups < 1 {
+		// Keep the previous file to roll back to
+		opts.Backups = 1
+	}
+	if err := utils.WriteAliasesToFile(b, outfile, opts); err != nil {
+		return err
+	}
+	err = utils.RunHook(ctx, "post-write", hooks.PostWrite, hooks.Timeout, env)
+	if err == nil || !hooks.RollbackOnFailure {
+		return err
+	}
+	if !existed {
+		return fmt.Errorf("%s, and there was no previous aliases file to roll back to", err)
+	}
+	if rerr := utils.RollbackAliasesFile(outfile); rerr != nil {
+		return fmt.Errorf("%s, and rolling back failed: %s", err, rerr)
+	}
+	return fmt.Errorf("%s, rolled back to the previous aliases file", err)
+}
+
+// readAliases reads the aliases file written in format.
+func readAliases(ctx context.Context, file, format string) (generator.Aliases, error) {
+	formatter, err := generator.FormatterFor(format)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return formatter.Parse(ctx, f)
 }
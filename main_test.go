@@ -0,0 +1,750 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/myradiotest"
+	"github.com/UniversityRadioYork/myradio-go"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func init() {
+	// Exit codes are checked through the errors the app returns
+	cli.OsExiter = func(int) {}
+	cli.ErrWriter = ioutil.Discard
+}
+
+// e2e is a fake MyRadio and a config pointing at it, in a temporary directory.
+type e2e struct {
+	server *myradiotest.Server
+	dir    string
+	config string
+	out    string
+}
+
+func newE2E(t *testing.T, extraConfig string) *e2e {
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &e2e{
+		server: myradiotest.NewServer(myradiotest.Fixture()),
+		dir:    dir,
+		config: filepath.Join(dir, "config.toml"),
+		out:    filepath.Join(dir, "aliases"),
+	}
+	e.server.APIKey = "secret"
+	config := fmt.Sprintf(`HeadOfStation = "station.manager"
+AssistantHeadOfStation = "station.manager"
+ApiKey = "secret"
+ApiBaseURL = "%s"
+StandDownPeriod = 28
+
+[Retry]
+Attempts = 2
+InitialDelay = "1ms"
+%s`, e.server.URL, extraConfig)
+	if err := ioutil.WriteFile(e.config, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func (e *e2e) Close() {
+	e.server.Close()
+	os.RemoveAll(e.dir)
+}
+
+// run runs alias-go with the config and aliases file, followed by args,
+// returning what it wrote to stderr.
+func (e *e2e) run(args ...string) (string, error) {
+	var errOut bytes.Buffer
+	app := newApp(context.Background())
+	app.Writer = ioutil.Discard
+	app.ErrWriter = &errOut
+	err := app.Run(append([]string{"alias-go", "-c", e.config, "-o", e.out}, args...))
+	return errOut.String(), err
+}
+
+func (e *e2e) aliases(t *testing.T) string {
+	b, err := ioutil.ReadFile(e.out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+const expectedAliases = `computing: jane@example.com, 
+head.of.computing: jane@example.com, 
+headofcomputing: head.of.computing, 
+jane.doe: jane@example.com, 
+janedoe: jane.doe, 
+members: jane@example.com, sam@example.com, 
+station.manager: sam@example.com, 
+stationmanager: station.manager, 
+webmaster: head.of.computing, webmaster@example.org, 
+`
+
+// assertExit checks the app failed with code and a message containing message.
+func assertExit(err error, code int, message string, t *testing.T) {
+	t.Helper()
+	exit, ok := err.(cli.ExitCoder)
+	if !ok {
+		t.Fatalf("Expected to exit with %d, got '%v'", code, err)
+	}
+	if exit.ExitCode() != code || !strings.Contains(exit.Error(), message) {
+		t.Errorf("Expected to exit with %d and '%s', got %d and '%s'", code, message, exit.ExitCode(), exit.Error())
+	}
+}
+
+func TestMain_generate(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+
+	// The first call to MyRadio fails, and is retried
+	e.server.Fail(myradiotest.EndpointLists, myradiotest.Fault{Status: 503, Times: 1})
+
+	_, err := e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases := e.aliases(t)
+	if !strings.HasPrefix(aliases, "# Generated: ") || !strings.HasSuffix(aliases, "\n"+expectedAliases) {
+		t.Errorf("expected \n%s, got \n%s", expectedAliases, aliases)
+	}
+	if e.server.Requests(myradiotest.EndpointLists) != 2 {
+		t.Errorf("Expected the lists to be fetched twice, got %d", e.server.Requests(myradiotest.EndpointLists))
+	}
+
+	_, err = e.run("diff")
+	if err != nil {
+		t.Errorf("Expected no differences, got '%v'", err)
+	}
+
+}
+
+func TestMain_generate_myRadioFails(t *testing.T) {
+
+	faults := map[string]myradiotest.Fault{
+		"not ok: 500":                  {Status: 500},
+		"unexpected end of JSON input": {Malformed: true},
+	}
+
+	for message, fault := range faults {
+		e := newE2E(t, "")
+		e.server.Fail(myradiotest.EndpointOfficers, fault)
+
+		_, err := e.run()
+
+		assertExit(err, 1, message, t)
+		if _, err := os.Stat(e.out); !os.IsNotExist(err) {
+			t.Errorf("Expected no aliases file to be written, got '%v'", err)
+		}
+		e.Close()
+	}
+
+}
+
+func TestMain_generate_timeout(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+
+	e.server.Fail(myradiotest.EndpointMiscAliases, myradiotest.Fault{Latency: time.Minute})
+
+	_, err := e.run("--timeout", "50ms")
+
+	assertExit(err, 1, "Timed out after 50ms waiting for MyRadio", t)
+	if _, err := os.Stat(e.out); !os.IsNotExist(err) {
+		t.Errorf("Expected no aliases file to be written, got '%v'", err)
+	}
+
+}
+
+func TestMain_generate_snapshot(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+	config, err := ioutil.ReadFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(e.dir, "snapshot.json")
+	config = append([]byte(fmt.Sprintf("SnapshotFile = \"%s\"\n", snapshot)), config...)
+	if err := ioutil.WriteFile(e.config, config, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only runs which write the aliases replace the snapshot
+	_, err = e.run("diff")
+	assertExit(err, 1, "", t)
+	if _, err := os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Errorf("Expected diff not to save a snapshot, got '%v'", err)
+	}
+
+	_, err = e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Fatalf("Expected a snapshot to be saved, got '%v'", err)
+	}
+
+	for _, endpoint := range []string{
+		myradiotest.EndpointLists,
+		myradiotest.EndpointMiscAliases,
+		myradiotest.EndpointOfficers,
+		myradiotest.EndpointUserAliases,
+	} {
+		e.server.Fail(endpoint, myradiotest.Fault{Status: 502})
+	}
+	os.Remove(e.out)
+
+	warning, err := e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(warning, `level=WARN msg="MyRadio was unreachable, the aliases were generated from the snapshot"`) {
+		t.Errorf("Expected a warning that the snapshot was used, got '%s'", warning)
+	}
+	if strings.Contains(warning, "secret") {
+		t.Errorf("Expected the API key to be redacted, got '%s'", warning)
+	}
+	aliases := e.aliases(t)
+	if !strings.Contains(strings.SplitN(aliases, "\n", 2)[0], "from the snapshot of MyRadio taken") {
+		t.Errorf("Expected the header to name the snapshot, got '%s'", strings.SplitN(aliases, "\n", 2)[0])
+	}
+	if !strings.HasSuffix(aliases, "\n"+expectedAliases) {
+		t.Errorf("expected \n%s, got \n%s", expectedAliases, aliases)
+	}
+
+}
+
+// waitFor polls cond until it is true, failing the test if it takes too long.
+func waitFor(cond func() bool, what string, t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMain_daemon(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var errOut bytes.Buffer
+	app := newApp(ctx)
+	app.Writer = ioutil.Discard
+	app.ErrWriter = &errOut
+	done := make(chan error)
+	go func() {
+		done <- app.Run([]string{"alias-go", "-c", e.config, "-o", e.out, "daemon", "--interval", "10ms"})
+	}()
+
+	waitFor(func() bool {
+		_, err := os.Stat(e.out)
+		return err == nil
+	}, "the aliases file", t)
+	first, err := os.Stat(e.out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has changed, so the file is left alone
+	runs := e.server.Requests(myradiotest.EndpointLists)
+	waitFor(func() bool { return e.server.Requests(myradiotest.EndpointLists) >= runs+3 }, "more runs", t)
+	unchanged, err := os.Stat(e.out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(first, unchanged) {
+		t.Error("Expected the aliases file not to be replaced when nothing changed")
+	}
+
+	// Failed runs keep the last good aliases
+	e.server.Fail(myradiotest.EndpointOfficers, myradiotest.Fault{Status: 500})
+	runs = e.server.Requests(myradiotest.EndpointOfficers)
+	waitFor(func() bool { return e.server.Requests(myradiotest.EndpointOfficers) >= runs+4 }, "failed runs", t)
+	if aliases := e.aliases(t); !strings.HasSuffix(aliases, "\n"+expectedAliases) {
+		t.Errorf("Expected the last good aliases to be kept, got \n%s", aliases)
+	}
+	e.server.Fail(myradiotest.EndpointOfficers, myradiotest.Fault{Times: 1})
+
+	// Changes are written
+	data := myradiotest.Fixture()
+	data.MemberAliases = append(data.MemberAliases, myradio.UserAlias{Source: "sam.smith", Destination: "sam@example.com"})
+	e.server.SetData(data)
+	waitFor(func() bool { return strings.Contains(e.aliases(t), "sam.smith: sam@example.com") }, "the new alias", t)
+
+	// Hanging up reloads the config
+	config, err := ioutil.ReadFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(e.config, append([]byte("Format = \"postfix-virtual\"\n"), config...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(func() bool { return strings.Contains(e.aliases(t), "sam.smith sam@example.com") }, "the new format", t)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the daemon to stop cleanly, got '%v'", err)
+	}
+	if !strings.Contains(errOut.String(), "Regenerating failed, keeping the last good aliases") {
+		t.Errorf("Expected the failed runs to be reported, got '%s'", errOut.String())
+	}
+
+}
+
+func TestMain_generate_hooks(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	calls := filepath.Join(dir, "calls")
+	veto := filepath.Join(dir, "veto")
+	broken := filepath.Join(dir, "broken")
+	e := newE2E(t, fmt.Sprintf(`
+[Hooks]
+PreWrite = "test ! -e %s"
+PostWrite = "echo $ALIASGO_ALIAS_COUNT $ALIASGO_ADDED $ALIASGO_REMOVED >> %s; test ! -e %s"
+RollbackOnFailure = true
+`, veto, calls, broken))
+	defer e.Close()
+
+	assertCalls := func(expected string) {
+		t.Helper()
+		b, err := ioutil.ReadFile(calls)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("Expected the post-write hook calls \n%s, got \n%s", expected, b)
+		}
+	}
+
+	_, err = e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCalls("9 9 0\n")
+
+	// The hooks only run when the aliases change
+	_, err = e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCalls("9 9 0\n")
+
+	data := myradiotest.Fixture()
+	data.MemberAliases = append(data.MemberAliases, myradio.UserAlias{Source: "sam.smith", Destination: "sam@example.com"})
+	e.server.SetData(data)
+
+	// A failing pre-write hook stops the write
+	if err := ioutil.WriteFile(veto, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.run()
+	assertExit(err, 1, "The pre-write hook", t)
+	if aliases := e.aliases(t); strings.Contains(aliases, "sam.smith") {
+		t.Errorf("Expected the aliases file to be left alone, got \n%s", aliases)
+	}
+	assertCalls("9 9 0\n")
+	os.Remove(veto)
+
+	// A failing post-write hook rolls back to the previous file
+	if err := ioutil.WriteFile(broken, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.run()
+	assertExit(err, 1, "rolled back to the previous aliases file", t)
+	if aliases := e.aliases(t); !strings.HasSuffix(aliases, "\n"+expectedAliases) {
+		t.Errorf("Expected the previous aliases to be restored, got \n%s", aliases)
+	}
+	assertCalls("9 9 0\n11 2 0\n")
+
+}
+
+func TestMain_generate_metrics(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+	config, err := ioutil.ReadFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := filepath.Join(e.dir, "alias-go.prom")
+	config = append([]byte(fmt.Sprintf("MetricsFile = \"%s\"\n", metrics)), config...)
+	if err := ioutil.WriteFile(e.config, config, 0600); err != nil {
+		t.Fatal(err)
+	}
+	data := myradiotest.Fixture()
+	data.MemberAliases = append(data.MemberAliases, myradio.UserAlias{Source: "nobody"})
+	e.server.SetData(data)
+	e.server.Fail(myradiotest.EndpointLists, myradiotest.Fault{Status: 503, Times: 1})
+
+	_, err = e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"aliasgo_runs_total{result=\"success\"} 1\n",
+		"aliasgo_runs_total{result=\"failure\"} 0\n",
+		"aliasgo_last_run_success 1\n",
+		"aliasgo_aliases 9\n",
+		"aliasgo_recipients 11\n",
+		"aliasgo_generator_aliases{generator=\"misc\"} 1\n",
+		"aliasgo_generator_recipients{generator=\"mailing list\"} 3\n",
+		"aliasgo_skipped{reason=\"member_alias_blank\"} 1\n",
+		"aliasgo_myradio_call_errors_total{call=\"GetMailingLists\"} 1\n",
+		"aliasgo_myradio_call_duration_seconds_count{call=\"GetMailingLists\"} 2\n",
+		"aliasgo_last_write_timestamp_seconds ",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("Expected the metrics to contain '%s', got \n%s", strings.TrimSpace(expected), b)
+		}
+	}
+
+	// Failed runs are recorded too
+	e.server.Fail(myradiotest.EndpointOfficers, myradiotest.Fault{Status: 500})
+
+	_, err = e.run()
+	assertExit(err, 1, "not ok: 500", t)
+
+	b, err = ioutil.ReadFile(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "aliasgo_runs_total{result=\"failure\"} 1\n") ||
+		!strings.Contains(string(b), "aliasgo_last_run_success 0\n") {
+		t.Errorf("Expected the failed run to be recorded, got \n%s", b)
+	}
+
+}
+
+func TestMain_generate_logging(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+	data := myradiotest.Fixture()
+	data.MemberAliases = append(data.MemberAliases, myradio.UserAlias{Source: "nobody"})
+	e.server.SetData(data)
+
+	stderr, err := e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, "level=WARN msg=\"Skipping a member alias with a blank source or destination\"") ||
+		!strings.Contains(stderr, "alias=nobody") {
+		t.Errorf("Expected the blank alias to be logged, got '%s'", stderr)
+	}
+
+	stderr, err = e.run("-q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stderr != "" {
+		t.Errorf("Expected nothing to be logged with -q, got '%s'", stderr)
+	}
+
+	logfile := filepath.Join(e.dir, "alias-go.log")
+	stderr, err = e.run("-v", "--log-format", "json", "--log-file", logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stderr != "" {
+		t.Errorf("Expected nothing on stderr with a log file, got '%s'", stderr)
+	}
+	b, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped, info bool
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record, got '%s': %s", line, err)
+		}
+		if record["alias"] == "nobody" && record["category"] == "data_quality" && record["level"] == "WARN" {
+			skipped = true
+		}
+		if record["level"] == "INFO" {
+			info = true
+		}
+	}
+	if !skipped || !info {
+		t.Errorf("Expected the blank alias and information to be logged as JSON, got \n%s", b)
+	}
+
+	// Failures beside the aliases themselves are logged as records too
+	stderr, err = e.run("--log-format", "json", "--report", filepath.Join(e.dir, "missing", "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, `"level":"WARN","msg":"Unable to write the report"`) ||
+		!strings.Contains(stderr, `"file":"`+filepath.Join(e.dir, "missing", "report.md")+`"`) {
+		t.Errorf("Expected the report failure to be logged as JSON, got '%s'", stderr)
+	}
+	stderr, err = e.run("-q", "--report", filepath.Join(e.dir, "missing", "report.md"))
+	if err != nil || stderr != "" {
+		t.Errorf("Expected the report failure not to be logged with -q, got '%s' and '%v'", stderr, err)
+	}
+
+	_, err = e.run("-q", "-v")
+	assertExit(err, 1, "--quiet can't be used with --verbose", t)
+	_, err = e.run("--log-format", "xml")
+	assertExit(err, 1, "Unknown log format 'xml'", t)
+
+}
+
+func TestMain_generate_report(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+	data := myradiotest.Fixture()
+	data.MemberAliases = append(data.MemberAliases, myradio.UserAlias{Source: "nobody"})
+	e.server.SetData(data)
+
+	report := filepath.Join(e.dir, "report.md")
+	_, err := e.run("--report", report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "## Member aliases with a blank source or destination (1)\n\n" +
+		"| Object | ID | Problem |\n" +
+		"|--------|----|---------|\n" +
+		"| member alias |  | Member alias has a blank source or destination: 'nobody' to '' |\n"
+	if !strings.Contains(string(b), expected) {
+		t.Errorf("Expected the report to contain \n%s\ngot \n%s", expected, b)
+	}
+
+	report = filepath.Join(e.dir, "report.txt")
+	_, err = e.run("--report", report, "--report-format", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"member_alias_blank": 1`) {
+		t.Errorf("Expected a JSON report, got \n%s", b)
+	}
+
+	_, err = e.run("--report", report, "--report-format", "pdf")
+	assertExit(err, 1, "Unknown report format 'pdf'", t)
+
+}
+
+func TestMain_generate_apiKeyCommand(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+	config, err := ioutil.ReadFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = bytes.Replace(config, []byte(`ApiKey = "secret"`), []byte(`ApiKeyCommand = "echo secret"`), 1)
+	if err := ioutil.WriteFile(e.config, config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr, err := e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := e.aliases(t); !strings.HasSuffix(actual, expectedAliases) {
+		t.Errorf("Expected the key to come from the command, got \n%s", actual)
+	}
+	if strings.Contains(stderr, "can be read by other users") {
+		t.Errorf("Expected no warning about a readable config without the key in it, got '%s'", stderr)
+	}
+
+	e.server.APIKey = "other"
+	_, err = e.run()
+	assertExit(err, 1, "api_key=[REDACTED]", t)
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected the API key to be redacted, got '%v'", err)
+	}
+
+}
+
+func TestMain_config(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+
+	var out bytes.Buffer
+	app := newApp(context.Background())
+	app.Writer = &out
+	app.ErrWriter = ioutil.Discard
+	if err := app.Run([]string{"alias-go", "-c", e.config, "config", "show"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `ApiKey = "[REDACTED]"`) || strings.Contains(out.String(), "secret") {
+		t.Errorf("Expected the config with the key redacted, got \n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `Format = "exim"`) || !strings.Contains(out.String(), "Attempts = 2") {
+		t.Errorf("Expected the effective config, got \n%s", out.String())
+	}
+	// The output is only the config, so it can be read back in
+	shown := filepath.Join(e.dir, "shown.toml")
+	if err := ioutil.WriteFile(shown, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := app.Run([]string{"alias-go", "-c", shown, "config", "check"}); err != nil {
+		t.Errorf("Expected the shown config to be valid, got '%v'", err)
+	}
+	if out.String() != shown+" is valid\n" {
+		t.Errorf("Expected only the result of the check on stdout, got '%s'", out.String())
+	}
+
+	_, err := e.run("config", "check")
+	if err != nil {
+		t.Errorf("Expected the config to be valid, got '%v'", err)
+	}
+
+	config, err := ioutil.ReadFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = bytes.Replace(config, []byte("StandDownPeriod = 28"), []byte("StandDownPeroid = 28\nFormat = \"qmail\""), 1)
+	if err := ioutil.WriteFile(e.config, config, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.run("config", "check")
+	assertExit(err, 1, e.config+":5: Unknown key 'StandDownPeroid', did you mean 'StandDownPeriod'?\n"+
+		e.config+":6: Unknown format 'qmail'", t)
+
+	_, err = e.run()
+	assertExit(err, 1, "Unknown key 'StandDownPeroid'", t)
+
+}
+
+func TestMain_generate_staticAliases(t *testing.T) {
+
+	e := newE2E(t, `
+[[alias]]
+source = "postmaster"
+destinations = ["root"]
+comment = "required by RFC 5321"
+
+[[alias]]
+source = "webmaster"
+destinations = ["web@example.org"]
+mode = "replace"
+
+[[alias]]
+source = "members"
+destinations = ["alumni@example.org"]
+`)
+	defer e.Close()
+
+	_, err := e.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases := e.aliases(t)
+	for _, expected := range []string{
+		"\nmembers: alumni@example.org, jane@example.com, sam@example.com, \n",
+		"\npostmaster: root, \n",
+		"\nwebmaster: web@example.org, \n",
+	} {
+		if !strings.Contains(aliases, expected) {
+			t.Errorf("Expected '%s' in \n%s", strings.TrimSpace(expected), aliases)
+		}
+	}
+
+	var out bytes.Buffer
+	app := newApp(context.Background())
+	app.Writer = &out
+	app.ErrWriter = ioutil.Discard
+	if err := app.Run([]string{"alias-go", "-c", e.config, "explain", "postmaster"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<- static: static alias in the config (append): required by RFC 5321") {
+		t.Errorf("Expected postmaster to be explained by the config, got \n%s", out.String())
+	}
+
+}
+
+func TestMain_generate_unchanged(t *testing.T) {
+
+	e := newE2E(t, "")
+	defer e.Close()
+	config, err := ioutil.ReadFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(e.config, append([]byte("Backups = 2\n"), config...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backups := func() int {
+		matches, err := filepath.Glob(e.out + ".*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(matches)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := e.run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := backups(); n != 0 {
+		t.Errorf("Expected unchanged runs not to back up the aliases file, got %d backups", n)
+	}
+
+	data := myradiotest.Fixture()
+	data.MemberAliases = append(data.MemberAliases, myradio.UserAlias{Source: "sam.smith", Destination: "sam@example.com"})
+	e.server.SetData(data)
+	if _, err := e.run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := backups(); n != 1 {
+		t.Errorf("Expected a changed run to back up the aliases file, got %d backups", n)
+	}
+
+	// A change of format is written even though the aliases are the same
+	if _, err := e.run("--format", "postfix-virtual"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(e.aliases(t), "sam.smith sam@example.com") {
+		t.Errorf("Expected the aliases in the new format, got \n%s", e.aliases(t))
+	}
+
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"github.com/UniversityRadioYork/alias-go/generator"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"os"
+	"time"
+)
+
+// runMetrics describe alias-go's runs and its calls to MyRadio.
+// A nil *runMetrics records nothing.
+type runMetrics struct {
+	registry *prometheus.Registry
+
+	runs                *prometheus.CounterVec
+	runDuration         prometheus.Histogram
+	lastRun             prometheus.Gauge
+	lastRunSuccess      prometheus.Gauge
+	lastSuccess         prometheus.Gauge
+	lastWrite           prometheus.Gauge
+	aliases             prometheus.Gauge
+	recipients          prometheus.Gauge
+	generatorAliases    *prometheus.GaugeVec
+	generatorRecipients *prometheus.GaugeVec
+	skipped             *prometheus.GaugeVec
+	callDuration        *prometheus.HistogramVec
+	callErrors          *prometheus.CounterVec
+}
+
+func newRunMetrics() *runMetrics {
+	m := &runMetrics{
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aliasgo_runs_total",
+			Help: "Runs by whether they succeeded or failed.",
+		}, []string{"result"}),
+		runDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "aliasgo_run_duration_seconds",
+			Help:    "How long runs took, from fetching to writing the aliases file.",
+			Buckets: []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aliasgo_last_run_timestamp_seconds",
+			Help: "When the last run finished.",
+		}),
+		lastRunSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aliasgo_last_run_success",
+			Help: "1 if the last run succeeded, 0 if it failed.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aliasgo_last_success_timestamp_seconds",
+			Help: "When the last run that succeeded finished.",
+		}),
+		lastWrite: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aliasgo_last_write_timestamp_seconds",
+			Help: "When the aliases file was last replaced.",
+		}),
+		aliases: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aliasgo_aliases",
+			Help: "Aliases generated by the last run that succeeded.",
+		}),
+		recipients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aliasgo_recipients",
+			Help: "Destinations of every alias generated by the last run that succeeded.",
+		}),
+		generatorAliases: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "aliasgo_generator_aliases",
+			Help: "Aliases each generator added destinations to in the last run that succeeded.",
+		}, []string{"generator"}),
+		generatorRecipients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "aliasgo_generator_recipients",
+			Help: "Destinations each generator added in the last run that succeeded.",
+		}, []string{"generator"}),
+		skipped: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "aliasgo_skipped",
+			Help: "What MyRadio returned that the last run that succeeded couldn't use, by reason.",
+		}, []string{"reason"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "aliasgo_myradio_call_duration_seconds",
+			Help:    "How long calls to MyRadio took, including failed ones, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"call"}),
+		callErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aliasgo_myradio_call_errors_total",
+			Help: "Calls to MyRadio that failed, by method.",
+		}, []string{"call"}),
+	}
+	m.registry.MustRegister(m.runs, m.runDuration, m.lastRun, m.lastRunSuccess, m.lastSuccess,
+		m.lastWrite, m.aliases, m.recipients, m.generatorAliases, m.generatorRecipients,
+		m.skipped, m.callDuration, m.callErrors)
+	return m
+}
+
+// handler serves the metrics in the Prometheus exposition format.
+func (m *runMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeCall records a call to MyRadio.
+func (m *runMetrics) observeCall(call string, took time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.callDuration.WithLabelValues(call).Observe(took.Seconds())
+	if err != nil {
+		m.callErrors.WithLabelValues(call).Inc()
+	} else {
+		m.callErrors.WithLabelValues(call).Add(0)
+	}
+}
+
+// observeRun records a run that took took, which failed with err if it isn't nil
+// or generated result if it is, writing to outfile.
+func (m *runMetrics) observeRun(took time.Duration, result *generator.Result, err error, outfile string) {
+	if m == nil {
+		return
+	}
+	now := float64(time.Now().Unix())
+	m.runDuration.Observe(took.Seconds())
+	m.lastRun.Set(now)
+	if info, err := os.Stat(outfile); err == nil {
+		m.lastWrite.Set(float64(info.ModTime().Unix()))
+	}
+	if err != nil {
+		m.runs.WithLabelValues("failure").Inc()
+		m.runs.WithLabelValues("success").Add(0)
+		m.lastRunSuccess.Set(0)
+		return
+	}
+	m.runs.WithLabelValues("success").Inc()
+	m.runs.WithLabelValues("failure").Add(0)
+	m.lastRunSuccess.Set(1)
+	m.lastSuccess.Set(now)
+
+	m.aliases.Set(float64(len(result.Aliases)))
+	recipients := 0
+	for _, ds := range result.Aliases {
+		recipients += len(ds)
+	}
+	m.recipients.Set(float64(recipients))
+	m.generatorAliases.Reset()
+	m.generatorRecipients.Reset()
+	for g, c := range result.CountByGenerator() {
+		m.generatorAliases.WithLabelValues(g).Set(float64(c.Aliases))
+		m.generatorRecipients.WithLabelValues(g).Set(float64(c.Recipients))
+	}
+	for _, reason := range generator.SkipReasons {
+		m.skipped.WithLabelValues(reason).Set(float64(result.Report.Count(reason)))
+	}
+}
+
+// writeFile writes the metrics to file for the node exporter's textfile collector,
+// if file isn't empty. It is written through a temporary file, so the collector
+// never reads half of it.
+func (m *runMetrics) writeFile(file string) error {
+	if m == nil || file == "" {
+		return nil
+	}
+	return prometheus.WriteToTextfile(file, m.registry)
+}
@@ -0,0 +1,57 @@
+package myradiotest
+
+import (
+	"encoding/json"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"github.com/UniversityRadioYork/myradio-go"
+	"time"
+)
+
+// Fixture returns a small station: two lists, a misc alias,
+// a filled and a vacant officer position and a member alias.
+func Fixture() *utils.Snapshot {
+	jane := myradio.User{MemberID: 10, Fname: "Jane", Email: "jane@example.com", Receiveemail: true}
+	bob := myradio.User{MemberID: 11, Fname: "Bob", Email: "bob@example.com", Receiveemail: false}
+	sam := myradio.User{MemberID: 12, Fname: "Sam", Email: "sam@example.com", Receiveemail: true}
+
+	s := utils.NewSnapshot(time.Time{})
+	s.Lists = []myradio.List{
+		{Listid: 1, Name: "Computing", Address: "computing", Recipients: 2},
+		{Listid: 2, Name: "Everyone", Address: "members", Recipients: 3},
+	}
+	s.ListMembers[1] = []myradio.User{jane, bob}
+	s.ListMembers[2] = []myradio.User{jane, bob, sam}
+
+	webmaster := myradio.Alias{Id: 1, Source: "webmaster"}
+	for _, d := range []struct{ atype, value string }{
+		{"officer", `{"alias": "head.of.computing"}`},
+		{"text", `"webmaster@example.org"`},
+	} {
+		raw := json.RawMessage(d.value)
+		webmaster.Destinations = append(webmaster.Destinations, struct {
+			Atype string `json:"type"`
+			Value *json.RawMessage
+		}{d.atype, &raw})
+	}
+	s.MiscAliases = []myradio.Alias{webmaster}
+
+	s.OfficerPositions = []myradio.OfficerPosition{
+		{
+			OfficerID: 1,
+			Name:      "Head of Computing",
+			Alias:     "head.of.computing",
+			Team:      myradio.Team{TeamID: 1, Name: "Computing"},
+			Current:   []myradio.User{jane},
+		},
+		{
+			OfficerID: 2,
+			Name:      "Station Manager",
+			Alias:     "station.manager",
+			Team:      myradio.Team{TeamID: 2, Name: "Management"},
+		},
+	}
+	s.TeamHeads[2] = []myradio.Officer{{User: sam}}
+
+	s.MemberAliases = []myradio.UserAlias{{Source: "jane.doe", Destination: "jane@example.com"}}
+	return s
+}
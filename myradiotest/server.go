@@ -0,0 +1,183 @@
+// Package myradiotest provides a fake MyRadio API for tests.
+//
+// It serves fixture data for every endpoint alias-go calls, wrapped as
+// MyRadio wraps it, and can make any endpoint fail, slow down or return
+// malformed JSON.
+package myradiotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The endpoints alias-go calls, for Fail and Requests.
+// Endpoints for a list or team use the pattern with the id in place of %d.
+const (
+	EndpointLists       = "/list/alllists"
+	EndpointListMembers = "/list/%d/members"
+	EndpointMiscAliases = "/alias/allaliases"
+	EndpointOfficers    = "/officer/allofficerpositions"
+	EndpointUserAliases = "/user/allaliases"
+	EndpointTeamHeads   = "/team/%d/headpositions"
+)
+
+// Fault is what goes wrong with an endpoint.
+type Fault struct {
+	// Status is the HTTP status to respond with instead of 200, if it isn't 0.
+	Status int
+	// Latency is how long to wait before responding.
+	Latency time.Duration
+	// Malformed responds with JSON that can't be parsed.
+	Malformed bool
+	// Times is how many requests the fault applies to, 0 for all of them.
+	Times int
+}
+
+// Server is a fake MyRadio API.
+type Server struct {
+	*httptest.Server
+	// APIKey is the key requests must carry, any key is accepted if it is empty.
+	APIKey string
+
+	closed   chan struct{}
+	mu       sync.Mutex
+	data     *utils.Snapshot
+	faults   map[string]*Fault
+	requests map[string]int
+}
+
+// NewServer starts a fake MyRadio serving data, which the caller must not change.
+// Officer history is served as MyRadio sends it, so give it FromRaw and ToRaw
+// rather than From and To.
+// Close the server once it is finished with.
+func NewServer(data *utils.Snapshot) *Server {
+	s := &Server{
+		closed:   make(chan struct{}),
+		data:     data,
+		faults:   make(map[string]*Fault),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Close cuts short any responses being delayed by a fault and shuts the server down.
+func (s *Server) Close() {
+	close(s.closed)
+	s.Server.Close()
+}
+
+// SetData replaces the data served, which the caller must not change.
+func (s *Server) SetData(data *utils.Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+}
+
+// Fail makes requests to endpoint go wrong as f describes,
+// replacing any fault it already had.
+func (s *Server) Fail(endpoint string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[endpoint] = &f
+}
+
+// Requests returns how many requests have been made to endpoint.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+var idPath = regexp.MustCompile(`^/(list|team)/(\d+)/(members|headpositions)$`)
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path
+	s.mu.Lock()
+	s.requests[endpoint]++
+	fault := s.faults[endpoint]
+	data := s.data
+	var f Fault
+	if fault != nil {
+		f = *fault
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				delete(s.faults, endpoint)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+	if s.APIKey != "" && r.URL.Query().Get("api_key") != s.APIKey {
+		respond(w, http.StatusForbidden, "FAIL", "Invalid API key")
+		return
+	}
+	if f.Status != 0 {
+		respond(w, f.Status, "FAIL", http.StatusText(f.Status))
+		return
+	}
+	if f.Malformed {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "OK", "payload": [{`)
+		return
+	}
+
+	var payload interface{}
+	var ok bool
+	switch endpoint {
+	case EndpointLists:
+		payload, ok = data.Lists, true
+	case EndpointMiscAliases:
+		payload, ok = data.MiscAliases, true
+	case EndpointOfficers:
+		payload, ok = data.OfficerPositions, true
+	case EndpointUserAliases:
+		payload, ok = data.MemberAliases, true
+	default:
+		if m := idPath.FindStringSubmatch(endpoint); m != nil {
+			id, _ := strconv.ParseUint(m[2], 10, 64)
+			if m[1] == "list" && m[3] == "members" {
+				payload, ok = data.ListMembers[int(id)]
+			} else if m[1] == "team" && m[3] == "headpositions" {
+				payload, ok = data.TeamHeads[id]
+			}
+		}
+	}
+	if !ok {
+		respond(w, http.StatusNotFound, "FAIL", "Not found")
+		return
+	}
+	respond(w, http.StatusOK, "OK", payload)
+}
+
+// respond writes payload wrapped as MyRadio wraps it.
+func respond(w http.ResponseWriter, status int, s string, payload interface{}) {
+	if v := reflect.ValueOf(payload); v.Kind() == reflect.Slice && v.IsNil() {
+		// MyRadio sends an empty array rather than null
+		payload = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  s,
+		"payload": payload,
+	})
+}
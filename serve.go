@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/generator"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contentTypes holds the content type of each format that isn't plain text.
+var contentTypes = map[string]string{
+	"json": "application/json",
+	"yaml": "application/yaml",
+	"csv":  "text/csv; charset=utf-8",
+	"cdb":  "application/octet-stream",
+}
+
+// ServeReadHeaderTimeout is how long a client has to send its request headers.
+const ServeReadHeaderTimeout = 10 * time.Second
+
+// server serves the aliases from a daemon's last good run over HTTP.
+type server struct {
+	// ctx is used for triggered runs, so a client hanging up doesn't abandon a write
+	ctx    context.Context
+	daemon *daemon
+}
+
+// newServer returns the HTTP API for d.
+func newServer(ctx context.Context, d *daemon) http.Handler {
+	s := &server{ctx: ctx, daemon: d}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/aliases", s.get(s.aliases))
+	mux.HandleFunc("/aliases/", s.get(s.alias))
+	mux.HandleFunc("/reverse", s.get(s.reverse))
+	mux.HandleFunc("/healthz", s.get(s.healthz))
+	mux.HandleFunc("/generate", s.generate)
+	if d.metrics != nil {
+		mux.Handle("/metrics", d.metrics.handler())
+	}
+	return mux
+}
+
+// respondJSON writes v as JSON with status.
+func respondJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// respondError writes message as a JSON error with status.
+func respondError(w http.ResponseWriter, status int, message string) {
+	respondJSON(w, status, map[string]string{"error": message})
+}
+
+// get only lets GET and HEAD requests through to handler, which is given the last good aliases.
+func (s *server) get(handler func(http.ResponseWriter, *http.Request, *generator.Result)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			respondError(w, http.StatusMethodNotAllowed, "Only GET is allowed")
+			return
+		}
+		handler(w, r, s.daemon.Last())
+	}
+}
+
+// aliases serves every alias in the format given by the format parameter,
+// or the format the aliases file is written in.
+func (s *server) aliases(w http.ResponseWriter, r *http.Request, result *generator.Result) {
+	if result == nil {
+		respondError(w, http.StatusServiceUnavailable, "No aliases have been generated yet")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		_, format, _, _ = s.daemon.currentConfig()
+	}
+	formatter, err := generator.FormatterFor(format)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	b, err := formatter.Format(utils.WithLogger(r.Context(), utils.Logger(s.ctx)), result.Aliases, fmt.Sprintf("Generated: %s", s.daemon.Status().LastSuccess))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(b)
+}
+
+// aliasDestination is a destination of an alias along with why it is there.
+type aliasDestination struct {
+	Destination string   `json:"destination"`
+	Origins     []string `json:"origins"`
+}
+
+// aliasExpansion is an alias with its destinations and final recipients.
+type aliasExpansion struct {
+	Name         string             `json:"name"`
+	Destinations []aliasDestination `json:"destinations"`
+	Recipients   []string           `json:"recipients"`
+	// Loop explains why the recipients are missing when the alias loops back on itself.
+	Loop string `json:"loop,omitempty"`
+}
+
+// alias serves the destinations of the alias named in the path, where each one
+// came from, and the recipients they expand to.
+func (s *server) alias(w http.ResponseWriter, r *http.Request, result *generator.Result) {
+	if result == nil {
+		respondError(w, http.StatusServiceUnavailable, "No aliases have been generated yet")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/aliases/")
+	dests, exists := result.Aliases[name]
+	if !exists {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("No alias '%s'", name))
+		return
+	}
+	e := aliasExpansion{Name: name, Destinations: []aliasDestination{}}
+	sorted := append([]string(nil), dests...)
+	sort.Strings(sorted)
+	for _, d := range sorted {
+		origins := []string{}
+		for _, o := range result.Provenance.Of(name, d) {
+			origins = append(origins, o.String())
+		}
+		e.Destinations = append(e.Destinations, aliasDestination{Destination: d, Origins: origins})
+	}
+	recipients, err := result.Aliases.Expand(name)
+	if err != nil {
+		e.Loop = err.Error()
+	}
+	e.Recipients = recipients
+	if e.Recipients == nil {
+		e.Recipients = []string{}
+	}
+	respondJSON(w, http.StatusOK, e)
+}
+
+// reverse serves the aliases that deliver to the email parameter.
+func (s *server) reverse(w http.ResponseWriter, r *http.Request, result *generator.Result) {
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		respondError(w, http.StatusBadRequest, "An email parameter is required")
+		return
+	}
+	if result == nil {
+		respondError(w, http.StatusServiceUnavailable, "No aliases have been generated yet")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"email":   email,
+		"aliases": s.daemon.Status().Reverse.Lookup(email),
+	})
+}
+
+// health is the body of /healthz.
+type health struct {
+	// Status is "ok" if the last run succeeded, "failing" if it failed
+	// and "starting" if there hasn't been one yet.
+	Status        string     `json:"status"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	SnapshotTaken *time.Time `json:"snapshot_taken,omitempty"`
+	Aliases       int        `json:"aliases"`
+}
+
+// healthz serves how the daemon's runs have gone, failing unless the last one succeeded.
+func (s *server) healthz(w http.ResponseWriter, r *http.Request, result *generator.Result) {
+	status := s.daemon.Status()
+	h := health{Status: "starting"}
+	code := http.StatusServiceUnavailable
+	if !status.LastSuccess.IsZero() {
+		h.LastSuccess = &status.LastSuccess
+	}
+	if status.LastError != nil {
+		h.Status = "failing"
+		h.LastError = status.LastError.Error()
+		h.LastErrorAt = &status.LastErrorAt
+	} else if result != nil {
+		h.Status = "ok"
+		code = http.StatusOK
+	}
+	if result != nil {
+		h.Aliases = len(result.Aliases)
+		if !result.SnapshotTaken.IsZero() {
+			h.SnapshotTaken = &result.SnapshotTaken
+		}
+	}
+	respondJSON(w, code, h)
+}
+
+// generate runs the daemon straight away, once any run in progress has finished,
+// for POST requests carrying Serve.Token.
+// The token is read from the current config on every request, so reloading changes it.
+func (s *server) generate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		respondError(w, http.StatusMethodNotAllowed, "Only POST is allowed")
+		return
+	}
+	config, _, _, _ := s.daemon.currentConfig()
+	token := config.GetServeOptions().Token
+	if token == "" {
+		respondError(w, http.StatusForbidden, "Triggering runs is turned off, set Serve.Token to turn it on")
+		return
+	}
+	given, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !bearer || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		respondError(w, http.StatusUnauthorized, "A valid bearer token is required")
+		return
+	}
+	if err := s.daemon.regenerate(s.ctx); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "ok",
+		"aliases": len(s.daemon.Last().Aliases),
+	})
+}
+
+// serve runs d until ctx is done, serving its aliases over HTTP as opts says.
+func serve(ctx context.Context, d *daemon, opts utils.ServeOptions) error {
+	l, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler: newServer(ctx, d),
+		// Clients that never finish sending their headers are dropped rather than kept open
+		ReadHeaderTimeout: ServeReadHeaderTimeout,
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	utils.Logger(ctx).Info("Serving the aliases", "url", "http://"+l.Addr().String())
+	err = runDaemon(ctx, d)
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdown)
+	if serr := <-served; err == nil && serr != http.ErrServerClosed {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/UniversityRadioYork/alias-go/myradiotest"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newTestServer returns the HTTP API for a daemon generating from e's fake MyRadio.
+func newTestServer(e *e2e, t *testing.T) (*daemon, http.Handler) {
+	config, err := utils.NewConfigFromFile(e.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{
+		configfile: e.config,
+		outfile:    e.out,
+		config:     config,
+		metrics:    newRunMetrics(),
+	}
+	return d, newServer(context.Background(), d)
+}
+
+// request makes a request to h, returning the response's status and body.
+func request(h http.Handler, method, target, token string) (int, string) {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
+
+// assertResponse checks a response's status and that its body contains body.
+func assertResponse(status int, body string, expectedStatus int, expectedBody string, t *testing.T) {
+	t.Helper()
+	if status != expectedStatus || !strings.Contains(body, expectedBody) {
+		t.Errorf("Expected %d containing '%s', got %d with '%s'", expectedStatus, expectedBody, status, body)
+	}
+}
+
+func TestMain_serve(t *testing.T) {
+
+	e := newE2E(t, "\n[Serve]\nToken = \"token\"\n")
+	defer e.Close()
+	d, h := newTestServer(e, t)
+
+	status, body := request(h, "GET", "/healthz", "")
+	assertResponse(status, body, http.StatusServiceUnavailable, `"status":"starting"`, t)
+	status, body = request(h, "GET", "/aliases", "")
+	assertResponse(status, body, http.StatusServiceUnavailable, "No aliases have been generated yet", t)
+
+	// Triggering a run needs the token
+	status, body = request(h, "GET", "/generate", "token")
+	assertResponse(status, body, http.StatusMethodNotAllowed, "Only POST is allowed", t)
+	status, body = request(h, "POST", "/generate", "")
+	assertResponse(status, body, http.StatusUnauthorized, "A valid bearer token is required", t)
+	status, body = request(h, "POST", "/generate", "wrong")
+	assertResponse(status, body, http.StatusUnauthorized, "A valid bearer token is required", t)
+	status, body = request(h, "POST", "/generate", "token")
+	assertResponse(status, body, http.StatusOK, `"aliases":9`, t)
+	if aliases := e.aliases(t); !strings.HasSuffix(aliases, "\n"+expectedAliases) {
+		t.Errorf("Expected the run to write the aliases file, got \n%s", aliases)
+	}
+
+	status, body = request(h, "GET", "/aliases", "")
+	assertResponse(status, body, http.StatusOK, expectedAliases, t)
+	status, body = request(h, "GET", "/aliases?format=postfix-virtual", "")
+	assertResponse(status, body, http.StatusOK, "station.manager sam@example.com\n", t)
+	status, body = request(h, "GET", "/aliases?format=mbox", "")
+	assertResponse(status, body, http.StatusBadRequest, "Unknown format 'mbox'", t)
+
+	status, body = request(h, "GET", "/aliases/webmaster", "")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d with '%s'", status, body)
+	}
+	var expansion aliasExpansion
+	if err := json.Unmarshal([]byte(body), &expansion); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expansion.Recipients, []string{"jane@example.com", "webmaster@example.org"}) {
+		t.Errorf("Unexpected recipients %v", expansion.Recipients)
+	}
+	if len(expansion.Destinations) != 2 || expansion.Destinations[0].Destination != "head.of.computing" ||
+		len(expansion.Destinations[0].Origins) == 0 || !strings.HasPrefix(expansion.Destinations[0].Origins[0], "misc: ") {
+		t.Errorf("Unexpected destinations %+v", expansion.Destinations)
+	}
+	status, body = request(h, "GET", "/aliases/nobody", "")
+	assertResponse(status, body, http.StatusNotFound, "No alias 'nobody'", t)
+
+	status, body = request(h, "GET", "/reverse?email=sam@example.com", "")
+	assertResponse(status, body, http.StatusOK, `"aliases":["members","station.manager","stationmanager"]`, t)
+	status, body = request(h, "GET", "/reverse", "")
+	assertResponse(status, body, http.StatusBadRequest, "An email parameter is required", t)
+
+	status, body = request(h, "GET", "/healthz", "")
+	assertResponse(status, body, http.StatusOK, `"status":"ok"`, t)
+	status, body = request(h, "GET", "/metrics", "")
+	assertResponse(status, body, http.StatusOK, "aliasgo_runs_total{result=\"success\"} 1\n", t)
+
+	// A failed run is reported, while the last good aliases are still served
+	e.server.Fail(myradiotest.EndpointOfficers, myradiotest.Fault{Status: 500})
+	status, body = request(h, "POST", "/generate", "token")
+	assertResponse(status, body, http.StatusInternalServerError, "not ok: 500", t)
+	status, body = request(h, "GET", "/healthz", "")
+	assertResponse(status, body, http.StatusServiceUnavailable, `"status":"failing"`, t)
+	if !strings.Contains(body, `"last_error":`) || !strings.Contains(body, `"last_success":`) {
+		t.Errorf("Expected the last error and success to be reported, got '%s'", body)
+	}
+	status, body = request(h, "GET", "/aliases", "")
+	assertResponse(status, body, http.StatusOK, expectedAliases, t)
+
+	// Reloading the config changes the token straight away
+	setToken := func(token string) {
+		t.Helper()
+		config, err := ioutil.ReadFile(e.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config = regexp.MustCompile(`Token = ".*"`).ReplaceAll(config, []byte(`Token = "`+token+`"`))
+		if err := ioutil.WriteFile(e.config, config, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.reload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.server.Fail(myradiotest.EndpointOfficers, myradiotest.Fault{Times: 1})
+	setToken("rotated")
+	status, body = request(h, "POST", "/generate", "token")
+	assertResponse(status, body, http.StatusUnauthorized, "A valid bearer token is required", t)
+	status, body = request(h, "POST", "/generate", "rotated")
+	assertResponse(status, body, http.StatusOK, `"aliases":9`, t)
+
+	// Runs can't be triggered without a token
+	setToken("")
+	status, body = request(h, "POST", "/generate", "rotated")
+	assertResponse(status, body, http.StatusForbidden, "Triggering runs is turned off", t)
+
+}
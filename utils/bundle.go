@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/UniversityRadioYork/myradio-go"
+	"io/ioutil"
+	"time"
+)
+
+// BundleVersion is the version of the bundle format written by WriteBundleFile.
+// It goes up whenever a bundle written by this version couldn't be read by an older one.
+const BundleVersion = 1
+
+// Bundle is everything fetched from MyRadio to generate the aliases,
+// saved so they can be generated again without MyRadio.
+type Bundle struct {
+	Version int
+	Snapshot
+}
+
+// NewBundle returns an empty bundle of the current version, fetched at taken.
+func NewBundle(taken time.Time) *Bundle {
+	return &Bundle{Version: BundleVersion, Snapshot: *NewSnapshot(taken)}
+}
+
+// ReadBundleFile reads a bundle written by WriteBundleFile.
+func ReadBundleFile(file string) (*Bundle, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{Snapshot: *NewSnapshot(time.Time{})}
+	if err := json.Unmarshal(b, bundle); err != nil {
+		return nil, fmt.Errorf("Invalid bundle '%s': %s", file, err)
+	}
+	if bundle.Version < 1 {
+		return nil, fmt.Errorf("Invalid bundle '%s': it has no version", file)
+	}
+	if bundle.Version > BundleVersion {
+		return nil, fmt.Errorf("Bundle '%s' is version %d, this alias-go only reads up to version %d", file, bundle.Version, BundleVersion)
+	}
+	return bundle, nil
+}
+
+// WriteBundleFile replaces file with the bundle, indented so it can be read and diffed.
+// Only its owner may read it, as it holds members' details.
+func WriteBundleFile(b *Bundle, file string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, append(data, '\n'), WriteOptions{Mode: 0600})
+}
+
+// FileFetcher answers from a bundle rather than MyRadio.
+type FileFetcher struct {
+	bundle *Bundle
+}
+
+// NewFileFetcher returns a fetcher which answers from the bundle in file.
+func NewFileFetcher(file string) (FileFetcher, error) {
+	b, err := ReadBundleFile(file)
+	if err != nil {
+		return FileFetcher{}, err
+	}
+	return FileFetcher{bundle: b}, nil
+}
+
+// Taken returns when the bundle was fetched from MyRadio.
+func (f FileFetcher) Taken() time.Time {
+	return f.bundle.Taken
+}
+
+func (f FileFetcher) GetMailingLists() ([]myradio.List, error) {
+	return f.bundle.Lists, nil
+}
+
+func (f FileFetcher) GetMailingListMembers(list myradio.List) ([]myradio.User, error) {
+	members, ok := f.bundle.ListMembers[list.Listid]
+	if !ok {
+		return nil, fmt.Errorf("The bundle has no members for list '%s' with id: %d", list.Name, list.Listid)
+	}
+	return members, nil
+}
+
+func (f FileFetcher) GetMiscAliases() ([]myradio.Alias, error) {
+	return f.bundle.MiscAliases, nil
+}
+
+func (f FileFetcher) GetOfficerAliases() ([]myradio.OfficerPosition, error) {
+	return f.bundle.OfficerPositions, nil
+}
+
+func (f FileFetcher) GetMemberAliases() ([]myradio.UserAlias, error) {
+	return f.bundle.MemberAliases, nil
+}
+
+func (f FileFetcher) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
+	heads, ok := f.bundle.TeamHeads[t.TeamID]
+	if !ok {
+		return nil, fmt.Errorf("The bundle has no head for team '%s' with id: %d", t.Name, t.TeamID)
+	}
+	return heads, nil
+}
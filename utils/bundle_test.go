@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUtils_ReadBundleFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "bundle.json")
+
+	invalid := map[string]string{
+		`{"Version": 2}`: "Bundle '" + file + "' is version 2, this alias-go only reads up to version 1",
+		`{"Lists": []}`:  "Invalid bundle '" + file + "': it has no version",
+	}
+
+	for bundle, expected := range invalid {
+		if err := ioutil.WriteFile(file, []byte(bundle), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadBundleFile(file)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error '%s', got '%v'", expected, err)
+		}
+	}
+
+}
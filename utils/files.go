@@ -3,35 +3,223 @@ package utils
 import (
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const exampleconfig = `# This is an example config
 HeadOfStation = "station.manager"
 AssistantHeadOfStation = "assistant.station.manager"
-ApiKey = "apikeygoeshere"
-StandDownPeriod = 28 #days`
+ApiKey = "apikeygoeshere" # or load it from one of
+# ApiKeyEnv = "MYRADIO_API_KEY" # an environment variable
+# ApiKeyFile = "${CREDENTIALS_DIRECTORY}/myradio" # a file, such as a systemd credential or Docker secret
+# ApiKeyCommand = "pass show myradio/api-key" # the output of a command
+# ApiBaseURL = "https://ury.org.uk/api/v2" # the MyRadio API to use, this one by default
+StandDownPeriod = 28 #days
+AllowCycles = false # write aliases that loop back on themselves rather than failing
+FlattenAliases = false # replace destinations that are aliases with their recipients
+LocalMailboxes = ["root", "postmaster"] # destinations without a domain that aren't aliases
+DanglingPolicy = "warn" # or drop or fail, for destinations without a domain that lead nowhere
+FoldCase = false # treat destinations that only differ in case as duplicates
+Concurrency = 4 # calls to MyRadio that may run at once
+Format = "exim" # or sendmail, postfix-aliases, postfix-virtual, opensmtpd, json, yaml, csv or cdb
+Backups = 5 # previous aliases files to keep
+FileMode = "0644"
+# FileOwner = "root"
+# FileGroup = "Debian-exim"
+Interval = "15m" # how often the daemon regenerates the aliases
+SnapshotFile = "/var/lib/alias-go/snapshot.json" # MyRadio's responses, used when it is unreachable
+SnapshotMaxAge = "72h" # the oldest snapshot that may be used, "0" for any age
+# MetricsFile = "/var/lib/prometheus/node-exporter/alias-go.prom" # for the node exporter's textfile collector
+
+# Refuse to replace the aliases file if too much would be removed,
+# a limit of 0 turns it off
+[Safety]
+MaxRemovedPercent = 10.0
+MaxRemovedRecipients = 50
+RequiredAliases = ["station.manager"]
+
+# The HTTP API started by serve
+[Serve]
+Listen = "127.0.0.1:8025"
+# Token = "secret" # required to POST to /generate, which is turned off without one
+
+# Commands run with the shell around replacing the aliases file, only when
+# it changes. They are given ALIASGO_PATH, ALIASGO_FORMAT, ALIASGO_ALIAS_COUNT,
+# ALIASGO_ADDED, ALIASGO_REMOVED, ALIASGO_CHANGED, ALIASGO_RECIPIENTS_ADDED
+# and ALIASGO_RECIPIENTS_REMOVED
+[Hooks]
+# PreWrite = "/usr/local/bin/check-aliases" # the file isn't replaced if this fails
+# PostWrite = "newaliases && systemctl reload exim4"
+Timeout = "30s"
+RollbackOnFailure = true # put the previous file back if PostWrite fails
+
+# Retry calls to MyRadio that fail with one of the RetryOn errors,
+# waiting longer after each failure
+[Retry]
+Attempts = 3 # 1 turns retrying off
+InitialDelay = "1s"
+MaxDelay = "30s"
+Multiplier = 2.0
+Jitter = 0.2 # fraction of each wait that is random
+RetryOn = ["5xx", "timeout", "network"]
+
+# Aliases that aren't in MyRadio, merged into the generated ones after everything else.
+# mode is append (the default) to add the destinations to any generated alias with
+# the same source, or replace to throw away what was generated for it
+# [[alias]]
+# source = "postmaster"
+# destinations = ["root"]
+# comment = "required by RFC 5321"
+#
+# [[alias]]
+# source = "head.of.computing"
+# destinations = ["computing@example.org"]
+# mode = "replace"
+# comment = "while the post is being handed over"`
+
+// backupLayout is the layout of the UTC timestamp appended to backups of the aliases file,
+// so their order isn't upset by the clocks changing.
+const backupLayout = "20060102T150405.000000000"
 
 type Configurer interface {
 	IsHistoricalOfficerValid(now, to time.Time) (bool, error)
 	GetHeadOfStation() string
 	GetAssistantHeadOfStation() string
 	GetApiKey() string
+	GetAllowCycles() bool
+	GetFlattenAliases() bool
+	GetLocalMailboxes() []string
+	GetDanglingPolicy() string
+	GetFoldCase() bool
+	GetConcurrency() int
+	GetStaticAliases() []StaticAlias
 }
 
 type configData struct {
 	HeadOfStation          string
 	AssistantHeadOfStation string
 	ApiKey                 string
+	ApiKeyEnv              string
+	ApiKeyFile             string
+	ApiKeyCommand          string
+	ApiBaseURL             string
 	StandDownPeriod        int
+	Format                 string
+	AllowCycles            bool
+	FlattenAliases         bool
+	LocalMailboxes         []string
+	DanglingPolicy         string
+	FoldCase               bool
+	Concurrency            int
+	Backups                int
+	FileMode               string
+	FileOwner              string
+	FileGroup              string
+	Interval               string
+	SnapshotFile           string
+	SnapshotMaxAge         string
+	MetricsFile            string
+	Safety                 SafetyLimits
+	Retry                  retryData
+	Hooks                  hooksData
+	Serve                  ServeOptions
+	Aliases                []StaticAlias `toml:"alias"`
+}
+
+// hooksData is the Hooks section of the config, before it is checked.
+type hooksData struct {
+	PreWrite          string
+	PostWrite         string
+	Timeout           string
+	RollbackOnFailure bool
+}
+
+// retryData is the Retry section of the config, before it is checked.
+// Multiplier and Jitter are nil unless the config sets them, as 0 is a valid Jitter.
+type retryData struct {
+	Attempts     int
+	InitialDelay string
+	MaxDelay     string
+	Multiplier   *float64
+	Jitter       *float64
+	RetryOn      []string
+}
+
+// SafetyLimits guard against replacing the aliases file with one that has
+// shrunk unexpectedly, such as when MyRadio returns a partial dataset.
+// Limits that are 0 are not checked.
+type SafetyLimits struct {
+	// MaxRemovedPercent is the largest percentage of aliases that may be removed.
+	MaxRemovedPercent float64
+	// MaxRemovedRecipients is the largest number of recipients that may be removed, across all aliases.
+	MaxRemovedRecipients int
+	// RequiredAliases must always be present.
+	RequiredAliases []string
+}
+
+// WriteOptions controls how the aliases file is replaced.
+type WriteOptions struct {
+	// Backups is the number of previous aliases files to keep.
+	Backups int
+	// Mode is the permissions given to the aliases file.
+	Mode os.FileMode
+	// Owner and Group are the names of the user and group to own the
+	// aliases file, if they are empty it is left to the defaults.
+	Owner string
+	Group string
+}
+
+// SnapshotOptions controls the snapshot of MyRadio kept for when it is unreachable.
+type SnapshotOptions struct {
+	// File is where the snapshot is kept, if it is empty no snapshot is kept.
+	File string
+	// MaxAge is the oldest a snapshot may be to be used, 0 allows any age.
+	MaxAge time.Duration
+}
+
+// ServeOptions controls the HTTP API started by serve.
+type ServeOptions struct {
+	// Listen is the address to listen on.
+	Listen string
+	// Token must be given as a bearer token to trigger a run,
+	// if it is empty runs can't be triggered.
+	Token string
+}
+
+// The ways a static alias is merged into the generated aliases.
+const (
+	// StaticAppend adds the destinations to any generated alias with the same source.
+	StaticAppend = "append"
+	// StaticReplace throws away the destinations generated for the source.
+	StaticReplace = "replace"
+)
+
+// StaticAlias is an alias given in the config as an [[alias]] table,
+// for addresses that aren't in MyRadio.
+type StaticAlias struct {
+	Source       string   `toml:"source"`
+	Destinations []string `toml:"destinations"`
+	// Mode is StaticAppend or StaticReplace.
+	Mode string `toml:"mode"`
+	// Comment says why the alias is there.
+	Comment string `toml:"comment"`
 }
 
 type Config struct {
 	Configurer
 	configData
+	// file is the config file the config was loaded from, and lines
+	// the line each key was set on, for errors to point to
+	file  string
+	lines map[string]int
 }
 
 func (c Config) GetHeadOfStation() string {
@@ -42,10 +230,210 @@ func (c Config) GetAssistantHeadOfStation() string {
 	return c.configData.AssistantHeadOfStation
 }
 
+// GetApiKey returns the MyRadio API key, loaded from wherever the config says it is.
 func (c Config) GetApiKey() string {
 	return c.configData.ApiKey
 }
 
+// GetApiBaseURL returns the base URL of the MyRadio API,
+// or "" to use the default.
+func (c Config) GetApiBaseURL() string {
+	return c.configData.ApiBaseURL
+}
+
+// GetAllowCycles returns whether aliases that loop back on themselves
+// should be written anyway rather than failing the generation.
+func (c Config) GetAllowCycles() bool {
+	return c.configData.AllowCycles
+}
+
+// GetFlattenAliases returns whether destinations that are aliases
+// should be replaced by their final recipients.
+func (c Config) GetFlattenAliases() bool {
+	return c.configData.FlattenAliases
+}
+
+// GetLocalMailboxes returns the names of the local mailboxes
+// that destinations without a domain may deliver to.
+func (c Config) GetLocalMailboxes() []string {
+	return c.configData.LocalMailboxes
+}
+
+// GetDanglingPolicy returns what to do with local destinations that are
+// neither an alias nor a local mailbox: warn, drop or fail.
+func (c Config) GetDanglingPolicy() string {
+	return c.configData.DanglingPolicy
+}
+
+// GetFoldCase returns whether destinations that only differ
+// in case should be treated as duplicates.
+func (c Config) GetFoldCase() bool {
+	return c.configData.FoldCase
+}
+
+// GetConcurrency returns how many calls to MyRadio may run at once.
+func (c Config) GetConcurrency() int {
+	return c.configData.Concurrency
+}
+
+// GetStaticAliases returns the aliases given in the config, in the order they are given,
+// with their mode defaulting to StaticAppend.
+func (c Config) GetStaticAliases() []StaticAlias {
+	aliases := make([]StaticAlias, len(c.configData.Aliases))
+	for i, a := range c.configData.Aliases {
+		if a.Mode == "" {
+			a.Mode = StaticAppend
+		}
+		aliases[i] = a
+	}
+	return aliases
+}
+
+// GetFormat returns the name of the format to write the aliases in.
+func (c Config) GetFormat() string {
+	return c.configData.Format
+}
+
+// GetSafetyLimits returns the limits on what may be removed from the aliases file.
+func (c Config) GetSafetyLimits() SafetyLimits {
+	return c.configData.Safety
+}
+
+// GetWriteOptions returns how the aliases file should be replaced.
+func (c Config) GetWriteOptions() (WriteOptions, error) {
+	o := WriteOptions{
+		Backups: c.configData.Backups,
+		Mode:    0644,
+		Owner:   c.configData.FileOwner,
+		Group:   c.configData.FileGroup,
+	}
+	if c.configData.FileMode != "" {
+		mode, err := strconv.ParseUint(c.configData.FileMode, 8, 32)
+		if err != nil {
+			return o, c.keyError("FileMode", "Invalid FileMode '%s', it should be in octal", c.configData.FileMode)
+		}
+		o.Mode = os.FileMode(mode)
+	}
+	return o, nil
+}
+
+// GetInterval returns how often the daemon regenerates the aliases, 15 minutes by default.
+func (c Config) GetInterval() (time.Duration, error) {
+	if c.configData.Interval == "" {
+		return 15 * time.Minute, nil
+	}
+	d, err := time.ParseDuration(c.configData.Interval)
+	if err != nil || d <= 0 {
+		return 0, c.keyError("Interval", "Invalid Interval '%s', it should be a duration such as \"15m\"", c.configData.Interval)
+	}
+	return d, nil
+}
+
+// GetSnapshotOptions returns where the snapshot of MyRadio is kept
+// and how old it may be, 72 hours by default.
+func (c Config) GetSnapshotOptions() (SnapshotOptions, error) {
+	o := SnapshotOptions{
+		File:   c.configData.SnapshotFile,
+		MaxAge: 72 * time.Hour,
+	}
+	if c.configData.SnapshotMaxAge != "" {
+		d, err := time.ParseDuration(c.configData.SnapshotMaxAge)
+		if err != nil || d < 0 {
+			return o, c.keyError("SnapshotMaxAge", "Invalid SnapshotMaxAge '%s', it should be a duration such as \"72h\"", c.configData.SnapshotMaxAge)
+		}
+		o.MaxAge = d
+	}
+	return o, nil
+}
+
+// GetMetricsFile returns where to write the metrics after each run,
+// or an empty string if they aren't written.
+func (c Config) GetMetricsFile() string {
+	return c.configData.MetricsFile
+}
+
+// GetServeOptions returns how to serve the HTTP API,
+// listening on 127.0.0.1:8025 by default.
+func (c Config) GetServeOptions() ServeOptions {
+	o := c.configData.Serve
+	if o.Listen == "" {
+		o.Listen = "127.0.0.1:8025"
+	}
+	return o
+}
+
+// GetHooks returns the commands to run around replacing the aliases file.
+// Hooks may run for 30 seconds by default.
+func (c Config) GetHooks() (Hooks, error) {
+	h := Hooks{
+		PreWrite:          c.configData.Hooks.PreWrite,
+		PostWrite:         c.configData.Hooks.PostWrite,
+		Timeout:           30 * time.Second,
+		RollbackOnFailure: c.configData.Hooks.RollbackOnFailure,
+	}
+	if c.configData.Hooks.Timeout != "" {
+		d, err := time.ParseDuration(c.configData.Hooks.Timeout)
+		if err != nil || d < 0 {
+			return h, c.keyError("Hooks.Timeout", "Invalid Hooks.Timeout '%s', it should be a duration such as \"30s\"", c.configData.Hooks.Timeout)
+		}
+		h.Timeout = d
+	}
+	return h, nil
+}
+
+// GetRetryPolicy returns how calls to MyRadio should be retried,
+// using DefaultRetryPolicy for anything the config doesn't say.
+func (c Config) GetRetryPolicy() (RetryPolicy, error) {
+	r := c.configData.Retry
+	p := DefaultRetryPolicy
+	if r.Attempts < 0 {
+		return p, c.keyError("Retry.Attempts", "Invalid Retry.Attempts %d, it should be at least 1", r.Attempts)
+	}
+	if r.Attempts > 0 {
+		p.Attempts = r.Attempts
+	}
+	var err error
+	if p.InitialDelay, err = c.parseRetryDelay("InitialDelay", r.InitialDelay, p.InitialDelay); err != nil {
+		return p, err
+	}
+	if p.MaxDelay, err = c.parseRetryDelay("MaxDelay", r.MaxDelay, p.MaxDelay); err != nil {
+		return p, err
+	}
+	if r.Multiplier != nil {
+		if *r.Multiplier < 1 {
+			return p, c.keyError("Retry.Multiplier", "Invalid Retry.Multiplier %g, it should be at least 1", *r.Multiplier)
+		}
+		p.Multiplier = *r.Multiplier
+	}
+	if r.Jitter != nil {
+		if *r.Jitter < 0 || *r.Jitter > 1 {
+			return p, c.keyError("Retry.Jitter", "Invalid Retry.Jitter %g, it should be between 0 and 1", *r.Jitter)
+		}
+		p.Jitter = *r.Jitter
+	}
+	if r.RetryOn != nil {
+		for _, class := range r.RetryOn {
+			if !isRetryClass(class) {
+				return p, c.keyError("Retry.RetryOn", "Invalid Retry.RetryOn '%s', it should be one of %s", class, strings.Join(RetryClasses, ", "))
+			}
+		}
+		p.RetryOn = r.RetryOn
+	}
+	return p, nil
+}
+
+// parseRetryDelay parses the Retry key name, returning def if it is empty.
+func (c Config) parseRetryDelay(name, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return def, c.keyError("Retry."+name, "Invalid Retry.%s '%s', it should be a duration such as \"1s\"", name, s)
+	}
+	return d, nil
+}
+
 func (c Config) IsHistoricalOfficerValid(now, to time.Time) (bool, error) {
 	var delta, err = time.ParseDuration(fmt.Sprintf("%dh", c.configData.StandDownPeriod*24))
 	if err != nil {
@@ -54,7 +442,10 @@ func (c Config) IsHistoricalOfficerValid(now, to time.Time) (bool, error) {
 	return (!to.IsZero() && now.Before(to.Add(delta))), nil
 }
 
-// NewConfigFromFile loads a config file and returns it.
+// NewConfigFromFile loads a config file and returns it, along with the API key
+// from wherever the config says it is.
+// Unknown keys and invalid values are returned as ConfigErrors, naming the line of each.
+// It warns if the config file holds the key itself and others can read it.
 func NewConfigFromFile(path string) (c Config, err error) {
 	absPath, _ := filepath.Abs(path)
 	b, err := ioutil.ReadFile(absPath)
@@ -63,13 +454,32 @@ func NewConfigFromFile(path string) (c Config, err error) {
 	}
 	s := string(b)
 	var cd configData
-	_, err = toml.Decode(s, &cd)
-	c = Config{configData: cd}
-	return
+	md, err := toml.Decode(s, &cd)
+	if err != nil {
+		return
+	}
+	c = Config{configData: cd, file: path, lines: keyLines(s)}
+	errs := ConfigErrors(c.unknownKeys(md.Undecoded()))
+	if cd.ApiKey != "" {
+		warnIfReadable(absPath)
+	}
+	c.configData.ApiKey, err = c.loadApiKey()
+	if err != nil {
+		errs = append(errs, c.asConfigError(err))
+	} else if verr, ok := c.Validate().(ConfigErrors); ok {
+		errs = append(errs, verr...)
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return c, errs
+	}
+	return c, nil
 }
 
+// WriteExampleConfigToFile writes the example config to path,
+// which only its owner may read as it has a place for the API key.
 func WriteExampleConfigToFile(path string) (err error) {
-	f, err := os.Create(path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return
 	}
@@ -78,13 +488,178 @@ func WriteExampleConfigToFile(path string) (err error) {
 	return
 }
 
-func WriteAliasesToFile(aliases, file string) (err error) {
-	f, err := os.Create(file)
+// WriteAliasesToFile replaces file with the formatted aliases.
+// The aliases are written to a temporary file which is synced to disk and
+// renamed over file, so file is never left partially written.
+// The previous file is kept as a backup if the options ask for any.
+func WriteAliasesToFile(aliases []byte, file string, opts WriteOptions) error {
+	return writeFileAtomic(file, aliases, opts)
+}
+
+// RollbackAliasesFile replaces file with its most recent backup.
+// The backup is used up, so rolling back again restores the one before it.
+func RollbackAliasesFile(file string) error {
+	backups, err := listBackups(file)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("No backups of '%s' to roll back to", file)
+	}
+	err = os.Rename(backups[len(backups)-1], file)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(file))
+}
+
+func writeFileAtomic(path string, data []byte, opts WriteOptions) (err error) {
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
 	if err != nil {
 		return
 	}
-	defer f.Close()
-	t := time.Now()
-	_, err = f.WriteString(fmt.Sprintf("# Generated: %s\n%s", t.String(), aliases))
-	return
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return
+	}
+	if err = f.Chmod(opts.Mode); err != nil {
+		return
+	}
+	if err = chown(f, opts.Owner, opts.Group); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	if opts.Backups > 0 {
+		if err = backup(path); err != nil {
+			return
+		}
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return
+	}
+	if err = syncDir(dir); err != nil {
+		return
+	}
+	return pruneBackups(path, opts.Backups)
+}
+
+// backup keeps the current file at path, if there is one, under a timestamped name.
+func backup(path string) error {
+	name := path + "." + time.Now().UTC().Format(backupLayout)
+	err := os.Link(path, name)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	// Not every filesystem supports hard links, so fall back to copying
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// listBackups returns the backups of path, oldest first.
+// The directory is read rather than globbed, as path may contain glob characters.
+func listBackups(path string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "."
+	type timedBackup struct {
+		name string
+		time time.Time
+	}
+	var timed []timedBackup
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		if t, err := time.Parse(backupLayout, strings.TrimPrefix(e.Name(), prefix)); err == nil {
+			timed = append(timed, timedBackup{filepath.Join(filepath.Dir(path), e.Name()), t})
+		}
+	}
+	sort.Slice(timed, func(i, j int) bool {
+		return timed[i].time.Before(timed[j].time)
+	})
+	backups := make([]string, len(timed))
+	for i, b := range timed {
+		backups[i] = b.name
+	}
+	return backups, nil
+}
+
+func pruneBackups(path string, keep int) error {
+	backups, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func chown(f *os.File, owner, group string) error {
+	if owner == "" && group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return err
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return err
+		}
+	}
+	return f.Chown(uid, gid)
+}
+
+// syncDir makes sure a rename in dir has reached the disk.
+// Not every platform can sync a directory, so failing to is not an error.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	d.Sync()
+	return d.Close()
 }
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUtils_WriteAliasesToFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "aliases")
+	opts := WriteOptions{
+		Backups: 2,
+		Mode:    0640,
+	}
+
+	for _, aliases := range []string{"a: 1, \n", "a: 2, \n", "a: 3, \n", "a: 4, \n"} {
+		err = WriteAliasesToFile([]byte(aliases), file, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertFileEndsWith(file, "a: 4, \n", t)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+
+	backups, err := listBackups(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected only the file and its backups, got %d files", len(entries))
+	}
+
+	err = RollbackAliasesFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileEndsWith(file, "a: 3, \n", t)
+
+	err = RollbackAliasesFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileEndsWith(file, "a: 2, \n", t)
+
+	err = RollbackAliasesFile(file)
+	if err == nil {
+		t.Error("Expected an error with no backups left")
+	}
+
+}
+
+func TestUtils_listBackups(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Glob characters in the path must be taken literally
+	file := filepath.Join(dir, "ali*ses")
+	for _, name := range []string{
+		"ali*ses.20241027T010000.000000000",
+		"ali*ses.20241027T005959.000000000",
+		"alixses.20241027T020000.000000000",
+		"ali*ses.tmp",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteAliasesToFile([]byte("a: 1, \n"), file, WriteOptions{Backups: 5, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteAliasesToFile([]byte("a: 2, \n"), file, WriteOptions{Backups: 5, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := listBackups(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 ||
+		filepath.Base(backups[0]) != "ali*ses.20241027T005959.000000000" ||
+		filepath.Base(backups[1]) != "ali*ses.20241027T010000.000000000" {
+		t.Fatalf("Expected the two old backups then the new one, got %v", backups)
+	}
+
+	// The newest backup is named after the time in UTC
+	stamp, err := time.Parse(backupLayout, strings.TrimPrefix(filepath.Base(backups[2]), "ali*ses."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(stamp); d < 0 || d > time.Minute {
+		t.Errorf("Expected the backup to be named after the time in UTC, got %s", stamp)
+	}
+
+}
+
+func TestUtils_GetWriteOptions(t *testing.T) {
+
+	c := Config{}
+
+	o, err := c.GetWriteOptions()
+
+	if err != nil {
+		t.Error(err)
+	}
+	if o.Mode != 0644 {
+		t.Errorf("Expected default mode 0644, got %o", o.Mode)
+	}
+
+	c.configData.FileMode = "0600"
+
+	o, err = c.GetWriteOptions()
+
+	if err != nil {
+		t.Error(err)
+	}
+	if o.Mode != 0600 {
+		t.Errorf("Expected mode 0600, got %o", o.Mode)
+	}
+
+	c.configData.FileMode = "rw-r--r--"
+
+	_, err = c.GetWriteOptions()
+
+	if err == nil {
+		t.Error("Expected an error for a non octal mode")
+	}
+
+}
+
+func assertFileEndsWith(file, expected string, t *testing.T) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), expected) {
+		t.Errorf("Expected '%s' to end with \n%s, got \n%s", file, expected, b)
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Hooks are commands run around replacing the aliases file,
+// such as running newaliases or reloading exim afterwards.
+type Hooks struct {
+	// PreWrite is run before the file is replaced, which is abandoned if it fails.
+	PreWrite string
+	// PostWrite is run after the file is replaced.
+	PostWrite string
+	// Timeout is how long each hook may run for, 0 for as long as it likes.
+	Timeout time.Duration
+	// RollbackOnFailure puts the previous file back if PostWrite fails.
+	RollbackOnFailure bool
+}
+
+// HookEnv describes a change to the aliases file to its hooks.
+// Added, Removed and Changed count aliases, while RecipientsAdded and
+// RecipientsRemoved count recipients across every alias, including changed ones.
+type HookEnv struct {
+	Path              string
+	Format            string
+	Aliases           int
+	Added             int
+	Removed           int
+	Changed           int
+	RecipientsAdded   int
+	RecipientsRemoved int
+}
+
+// Environ returns the environment variables describing the change.
+func (e HookEnv) Environ() []string {
+	return []string{
+		"ALIASGO_PATH=" + e.Path,
+		"ALIASGO_FORMAT=" + e.Format,
+		fmt.Sprintf("ALIASGO_ALIAS_COUNT=%d", e.Aliases),
+		fmt.Sprintf("ALIASGO_ADDED=%d", e.Added),
+		fmt.Sprintf("ALIASGO_REMOVED=%d", e.Removed),
+		fmt.Sprintf("ALIASGO_CHANGED=%d", e.Changed),
+		fmt.Sprintf("ALIASGO_RECIPIENTS_ADDED=%d", e.RecipientsAdded),
+		fmt.Sprintf("ALIASGO_RECIPIENTS_REMOVED=%d", e.RecipientsRemoved),
+	}
+}
+
+// RunHook runs command with the shell, if it isn't empty, adding env to the environment.
+// It fails if the command does, or if it is still running after timeout.
+func RunHook(ctx context.Context, name, command string, timeout time.Duration, env HookEnv) error {
+	if command == "" {
+		return nil
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env.Environ()...)
+	// Don't wait long for anything the hook left running with our output
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("The %s hook '%s' timed out after %s: %s", name, command, timeout, output)
+	}
+	if err != nil {
+		return fmt.Errorf("The %s hook '%s' failed, %s: %s", name, command, err, output)
+	}
+	Logger(ctx).Info("Ran a hook", "hook", name, "command", command, "output", output)
+	return nil
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUtils_RunHook(t *testing.T) {
+
+	env := HookEnv{Path: "/etc/aliases", Format: "exim", Aliases: 10, Added: 2, Removed: 1, Changed: 3, RecipientsAdded: 7, RecipientsRemoved: 4}
+
+	err := RunHook(context.Background(), "post-write", "", time.Second, env)
+	if err != nil {
+		t.Errorf("Expected an empty hook to do nothing, got '%v'", err)
+	}
+
+	err = RunHook(context.Background(), "post-write",
+		`test "$ALIASGO_PATH $ALIASGO_FORMAT $ALIASGO_ALIAS_COUNT $ALIASGO_ADDED $ALIASGO_REMOVED $ALIASGO_CHANGED $ALIASGO_RECIPIENTS_ADDED $ALIASGO_RECIPIENTS_REMOVED" = "/etc/aliases exim 10 2 1 3 7 4"`,
+		time.Second, env)
+	if err != nil {
+		t.Errorf("Expected the hook to be given the change, got '%v'", err)
+	}
+
+	err = RunHook(context.Background(), "pre-write", "echo broken; exit 3", time.Second, env)
+	expected := "The pre-write hook 'echo broken; exit 3' failed, exit status 3: broken"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error '%s', got '%v'", expected, err)
+	}
+
+	start := time.Now()
+	err = RunHook(context.Background(), "post-write", "sleep 10", 50*time.Millisecond, env)
+	if err == nil || !strings.HasPrefix(err.Error(), "The post-write hook 'sleep 10' timed out after 50ms") {
+		t.Errorf("Expected the hook to time out, got '%v'", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the hook to be killed when it timed out, took %s", time.Since(start))
+	}
+
+}
+
+func TestUtils_GetHooks(t *testing.T) {
+
+	h, err := Config{}.GetHooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Timeout != 30*time.Second || h.PreWrite != "" || h.PostWrite != "" || h.RollbackOnFailure {
+		t.Errorf("Expected no hooks with a 30s timeout, got %+v", h)
+	}
+
+	c := Config{configData: configData{Hooks: hooksData{PostWrite: "newaliases", Timeout: "5s", RollbackOnFailure: true}}}
+	h, err = c.GetHooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.PostWrite != "newaliases" || h.Timeout != 5*time.Second || !h.RollbackOnFailure {
+		t.Errorf("Unexpected hooks %+v", h)
+	}
+
+	c = Config{configData: configData{Hooks: hooksData{Timeout: "soon"}}}
+	_, err = c.GetHooks()
+	expected := "Invalid Hooks.Timeout 'soon', it should be a duration such as \"30s\""
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error '%s', got '%v'", expected, err)
+	}
+
+}
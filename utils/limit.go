@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"github.com/UniversityRadioYork/myradio-go"
+)
+
+// DefaultConcurrency is the number of calls to MyRadio
+// that may run at once if the config doesn't say.
+const DefaultConcurrency = 4
+
+// LimitedFetcher limits how many calls to a URYFetcherContext may run at once.
+// Calls waiting for their turn give up once their context is done.
+type LimitedFetcher struct {
+	fetcher URYFetcherContext
+	sem     chan struct{}
+}
+
+// NewLimitedFetcher wraps a URYFetcherContext so at most limit of its calls run at once.
+func NewLimitedFetcher(f URYFetcherContext, limit int) LimitedFetcher {
+	if limit < 1 {
+		limit = 1
+	}
+	return LimitedFetcher{fetcher: f, sem: make(chan struct{}, limit)}
+}
+
+// acquire waits for a turn, returning the function which ends it.
+func (l LimitedFetcher) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.sem <- struct{}{}:
+		return func() { <-l.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l LimitedFetcher) GetMailingListsContext(ctx context.Context) ([]myradio.List, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.fetcher.GetMailingListsContext(ctx)
+}
+
+func (l LimitedFetcher) GetMailingListMembersContext(ctx context.Context, list myradio.List) ([]myradio.User, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.fetcher.GetMailingListMembersContext(ctx, list)
+}
+
+func (l LimitedFetcher) GetMiscAliasesContext(ctx context.Context) ([]myradio.Alias, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.fetcher.GetMiscAliasesContext(ctx)
+}
+
+func (l LimitedFetcher) GetOfficerAliasesContext(ctx context.Context) ([]myradio.OfficerPosition, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.fetcher.GetOfficerAliasesContext(ctx)
+}
+
+func (l LimitedFetcher) GetMemberAliasesContext(ctx context.Context) ([]myradio.UserAlias, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.fetcher.GetMemberAliasesContext(ctx)
+}
+
+func (l LimitedFetcher) GetHeadOfTeamContext(ctx context.Context, t myradio.Team) ([]myradio.Officer, error) {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.fetcher.GetHeadOfTeamContext(ctx, t)
+}
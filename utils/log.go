@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// The names of fields in log records, which stay the same so logs can be filtered on them.
+const (
+	LogMemberID  = "member_id"
+	LogListID    = "list_id"
+	LogOfficerID = "officer_id"
+	LogTeamID    = "team_id"
+	LogMiscID    = "misc_id"
+	LogAlias     = "alias"
+	LogName      = "name"
+	LogAddress   = "address"
+	LogCategory  = "category"
+	LogError     = "error"
+	LogFile      = "file"
+)
+
+// CategoryDataQuality is the category of records about problems with MyRadio's data,
+// such as lists without addresses or members without emails.
+const CategoryDataQuality = "data_quality"
+
+// The formats logs can be written in.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+type loggerKey struct{}
+
+// WithLogger returns ctx carrying l, for Logger to find.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// Logger returns the logger ctx carries, or the default logger if it carries none.
+func Logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// DataQuality returns l, marking its records as being about problems with MyRadio's data.
+func DataQuality(l *slog.Logger) *slog.Logger {
+	return l.With(LogCategory, CategoryDataQuality)
+}
+
+// NewLogger returns a logger writing records at level and above to w in format,
+// which is LogFormatText or LogFormatJSON, with secrets redacted.
+func NewLogger(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case LogFormatText, "":
+		return slog.New(redactingHandler{slog.NewTextHandler(w, opts)}), nil
+	case LogFormatJSON:
+		return slog.New(redactingHandler{slog.NewJSONHandler(w, opts)}), nil
+	}
+	return nil, fmt.Errorf("Unknown log format '%s', it should be text or json", format)
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestUtils_NewLogger(t *testing.T) {
+
+	var b bytes.Buffer
+	l, err := NewLogger(&b, LogFormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("Hidden")
+	DataQuality(l).Warn("Skipping a list", LogListID, 4)
+	expected := `"level":"WARN","msg":"Skipping a list","category":"data_quality","list_id":4}`
+	if !strings.HasSuffix(strings.TrimSpace(b.String()), expected) {
+		t.Errorf("Expected a JSON record ending '%s', got '%s'", expected, b.String())
+	}
+	if strings.Contains(b.String(), "Hidden") {
+		t.Errorf("Expected debug records to be dropped at info level, got '%s'", b.String())
+	}
+
+	b.Reset()
+	l, err = NewLogger(&b, LogFormatText, slog.LevelWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithLogger(context.Background(), l)
+	Logger(ctx).Warn("Retrying", LogError, "timeout")
+	if !strings.Contains(b.String(), `level=WARN msg=Retrying error=timeout`) {
+		t.Errorf("Expected the logger carried by the context to be used, got '%s'", b.String())
+	}
+	if Logger(context.Background()) != slog.Default() {
+		t.Error("Expected the default logger without one in the context")
+	}
+
+	_, err = NewLogger(&b, "xml", slog.LevelWarn)
+	if err == nil || err.Error() != "Unknown log format 'xml', it should be text or json" {
+		t.Errorf("Expected an unknown format to fail, got '%v'", err)
+	}
+
+}
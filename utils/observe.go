@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"github.com/UniversityRadioYork/myradio-go"
+	"time"
+)
+
+// Observer is told how long each call to MyRadio took and whether it failed.
+// call is the name of the URYFetcher method, such as "GetMailingLists".
+type Observer func(call string, took time.Duration, err error)
+
+// ObservedFetcher is a URYFetcher which reports every call to an Observer.
+type ObservedFetcher struct {
+	fetcher URYFetcher
+	observe Observer
+}
+
+// NewObservedFetcher returns f, reporting every call to observe.
+func NewObservedFetcher(f URYFetcher, observe Observer) ObservedFetcher {
+	return ObservedFetcher{fetcher: f, observe: observe}
+}
+
+// observed runs call, reporting it as name.
+func (f ObservedFetcher) observed(name string, call func() error) error {
+	start := time.Now()
+	err := call()
+	f.observe(name, time.Since(start), err)
+	return err
+}
+
+func (f ObservedFetcher) GetMailingLists() (lists []myradio.List, err error) {
+	err = f.observed("GetMailingLists", func() (err error) {
+		lists, err = f.fetcher.GetMailingLists()
+		return
+	})
+	return
+}
+
+func (f ObservedFetcher) GetMailingListMembers(list myradio.List) (members []myradio.User, err error) {
+	err = f.observed("GetMailingListMembers", func() (err error) {
+		members, err = f.fetcher.GetMailingListMembers(list)
+		return
+	})
+	return
+}
+
+func (f ObservedFetcher) GetMiscAliases() (aliases []myradio.Alias, err error) {
+	err = f.observed("GetMiscAliases", func() (err error) {
+		aliases, err = f.fetcher.GetMiscAliases()
+		return
+	})
+	return
+}
+
+func (f ObservedFetcher) GetOfficerAliases() (officers []myradio.OfficerPosition, err error) {
+	err = f.observed("GetOfficerAliases", func() (err error) {
+		officers, err = f.fetcher.GetOfficerAliases()
+		return
+	})
+	return
+}
+
+func (f ObservedFetcher) GetMemberAliases() (aliases []myradio.UserAlias, err error) {
+	err = f.observed("GetMemberAliases", func() (err error) {
+		aliases, err = f.fetcher.GetMemberAliases()
+		return
+	})
+	return
+}
+
+func (f ObservedFetcher) GetHeadOfTeam(t myradio.Team) (heads []myradio.Officer, err error) {
+	err = f.observed("GetHeadOfTeam", func() (err error) {
+		heads, err = f.fetcher.GetHeadOfTeam(t)
+		return
+	})
+	return
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"github.com/UniversityRadioYork/myradio-go"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUtils_ObservedFetcher(t *testing.T) {
+
+	var calls []string
+	var errs []error
+	observe := func(call string, took time.Duration, err error) {
+		calls = append(calls, call)
+		errs = append(errs, err)
+	}
+
+	f := NewObservedFetcher(snapshotURY{}, observe)
+	lists, err := f.GetMailingLists()
+	if err != nil || len(lists) != 1 {
+		t.Errorf("Expected the list to be passed through, got %v and '%v'", lists, err)
+	}
+	f.GetHeadOfTeam(myradio.Team{TeamID: 2})
+
+	f = NewObservedFetcher(snapshotURY{down: true}, observe)
+	_, err = f.GetMemberAliases()
+	if err != errDown {
+		t.Errorf("Expected the error to be passed through, got '%v'", err)
+	}
+
+	expected := []string{"GetMailingLists", "GetHeadOfTeam", "GetMemberAliases"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v to be observed, got %v", expected, calls)
+	}
+	if !reflect.DeepEqual(errs, []error{nil, nil, errDown}) {
+		t.Errorf("Expected only the last call to be observed failing, got %v", errs)
+	}
+
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UniversityRadioYork/myradio-go"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The classes of error that a RetryPolicy may retry.
+const (
+	// RetryServerError is a 5xx response from MyRadio.
+	RetryServerError = "5xx"
+	// RetryTimeout is a request which timed out.
+	RetryTimeout = "timeout"
+	// RetryNetwork is a request which failed to connect or was cut off.
+	RetryNetwork = "network"
+)
+
+// RetryClasses are the classes of error that may be retried.
+var RetryClasses = []string{RetryServerError, RetryTimeout, RetryNetwork}
+
+// RetryPolicy decides how calls to MyRadio are retried.
+type RetryPolicy struct {
+	// Attempts is the most times each call is tried, 1 turns retrying off.
+	Attempts int
+	// InitialDelay is how long to wait before the first retry.
+	InitialDelay time.Duration
+	// MaxDelay caps how long to wait before any retry.
+	MaxDelay time.Duration
+	// Multiplier is how much longer each wait is than the one before.
+	Multiplier float64
+	// Jitter is the fraction of each wait that is random,
+	// so that concurrent calls don't retry in lockstep.
+	Jitter float64
+	// RetryOn are the classes of error to retry.
+	RetryOn []string
+}
+
+// DefaultRetryPolicy is used for anything the config doesn't say.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:     3,
+	InitialDelay: time.Second,
+	MaxDelay:     30 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.2,
+	RetryOn:      RetryClasses,
+}
+
+// delay returns how long to wait after the given failed attempt, counting from 1.
+func (p RetryPolicy) delay(attempt int, random float64) time.Duration {
+	d := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	return time.Duration(d * (1 - p.Jitter*random))
+}
+
+// retries returns whether the policy retries err.
+func (p RetryPolicy) retries(err error) bool {
+	class := errorClass(err)
+	for _, c := range p.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryClass returns whether class is one of RetryClasses.
+func isRetryClass(class string) bool {
+	for _, c := range RetryClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// notOK matches the error myradio-go returns for a response other than 200.
+var notOK = regexp.MustCompile(` not ok: (\d{3})`)
+
+// errorClass returns the class of a failed call to MyRadio,
+// or "" if it isn't one that might go away by itself.
+func errorClass(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// Our own deadline, retrying won't help
+		return ""
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return RetryTimeout
+	}
+	// The HTTP client wraps every error in a *url.Error, including
+	// certificate and protocol errors, so look for the transient ones inside
+	var opErr *net.OpError
+	if errors.As(err, &opErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return RetryNetwork
+	}
+	if m := notOK.FindStringSubmatch(err.Error()); m != nil {
+		if status, _ := strconv.Atoi(m[1]); status >= 500 {
+			return RetryServerError
+		}
+	}
+	return ""
+}
+
+// RetryFetcher retries the failed calls of another fetcher following a RetryPolicy.
+type RetryFetcher struct {
+	fetcher URYFetcherContext
+	policy  RetryPolicy
+	// sleep waits for d, giving up once ctx is done, and random returns
+	// a number in [0, 1) for the jitter; tests replace them.
+	sleep  func(ctx context.Context, d time.Duration) error
+	random func() float64
+}
+
+// NewRetryFetcher wraps f so its calls are retried following policy.
+func NewRetryFetcher(f URYFetcher, policy RetryPolicy) RetryFetcher {
+	return RetryFetcher{
+		fetcher: ContextFetcher(f),
+		policy:  policy,
+		sleep:   sleepContext,
+		random:  rand.Float64,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retry calls call until it succeeds, fails with an error the policy
+// doesn't retry or runs out of attempts, returning its last error.
+func (r RetryFetcher) retry(ctx context.Context, name string, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= r.policy.Attempts || !r.policy.retries(err) {
+			if err != nil && attempt > 1 {
+				return fmt.Errorf("%s failed after %d attempts: %w", name, attempt, err)
+			}
+			return err
+		}
+		d := r.policy.delay(attempt, r.random())
+		Logger(ctx).Warn("Retrying a call to MyRadio", "call", name, "delay", d,
+			"attempt", attempt, "attempts", r.policy.Attempts, LogError, err)
+		if err := r.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+func (r RetryFetcher) GetMailingListsContext(ctx context.Context) (lists []myradio.List, err error) {
+	err = r.retry(ctx, "fetching the mailing lists", func() (err error) {
+		lists, err = r.fetcher.GetMailingListsContext(ctx)
+		return
+	})
+	return
+}
+
+func (r RetryFetcher) GetMailingListMembersContext(ctx context.Context, list myradio.List) (members []myradio.User, err error) {
+	err = r.retry(ctx, fmt.Sprintf("fetching the members of list '%s'", list.Name), func() (err error) {
+		members, err = r.fetcher.GetMailingListMembersContext(ctx, list)
+		return
+	})
+	return
+}
+
+func (r RetryFetcher) GetMiscAliasesContext(ctx context.Context) (aliases []myradio.Alias, err error) {
+	err = r.retry(ctx, "fetching the misc aliases", func() (err error) {
+		aliases, err = r.fetcher.GetMiscAliasesContext(ctx)
+		return
+	})
+	return
+}
+
+func (r RetryFetcher) GetOfficerAliasesContext(ctx context.Context) (officers []myradio.OfficerPosition, err error) {
+	err = r.retry(ctx, "fetching the officer positions", func() (err error) {
+		officers, err = r.fetcher.GetOfficerAliasesContext(ctx)
+		return
+	})
+	return
+}
+
+func (r RetryFetcher) GetMemberAliasesContext(ctx context.Context) (aliases []myradio.UserAlias, err error) {
+	err = r.retry(ctx, "fetching the member aliases", func() (err error) {
+		aliases, err = r.fetcher.GetMemberAliasesContext(ctx)
+		return
+	})
+	return
+}
+
+func (r RetryFetcher) GetHeadOfTeamContext(ctx context.Context, t myradio.Team) (heads []myradio.Officer, err error) {
+	err = r.retry(ctx, fmt.Sprintf("fetching the head of team '%s'", t.Name), func() (err error) {
+		heads, err = r.fetcher.GetHeadOfTeamContext(ctx, t)
+		return
+	})
+	return
+}
+
+func (r RetryFetcher) GetMailingLists() ([]myradio.List, error) {
+	return r.GetMailingListsContext(context.Background())
+}
+
+func (r RetryFetcher) GetMailingListMembers(list myradio.List) ([]myradio.User, error) {
+	return r.GetMailingListMembersContext(context.Background(), list)
+}
+
+func (r RetryFetcher) GetMiscAliases() ([]myradio.Alias, error) {
+	return r.GetMiscAliasesContext(context.Background())
+}
+
+func (r RetryFetcher) GetOfficerAliases() ([]myradio.OfficerPosition, error) {
+	return r.GetOfficerAliasesContext(context.Background())
+}
+
+func (r RetryFetcher) GetMemberAliases() ([]myradio.UserAlias, error) {
+	return r.GetMemberAliasesContext(context.Background())
+}
+
+func (r RetryFetcher) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
+	return r.GetHeadOfTeamContext(context.Background(), t)
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/UniversityRadioYork/myradio-go"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyURY fails each call with the next of errs until it runs out, then succeeds.
+type flakyURY struct {
+	URYFetcher
+	errs  []error
+	calls int
+}
+
+func (ury *flakyURY) GetMailingLists() ([]myradio.List, error) {
+	ury.calls++
+	if ury.calls <= len(ury.errs) {
+		return nil, ury.errs[ury.calls-1]
+	}
+	return []myradio.List{{Listid: 1, Name: "Computing", Address: "computing"}}, nil
+}
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var (
+	errServer   = errors.New("https://ury.org.uk/api/v2/list/allLists not ok: 503 Service Unavailable")
+	errNotFound = errors.New("https://ury.org.uk/api/v2/list/allLists not ok: 404 Not Found")
+	errNetwork  = &url.Error{Op: "Get", URL: "https://ury.org.uk/api/v2/list/allLists", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	errTLS      = &url.Error{Op: "Get", URL: "https://ury.org.uk/api/v2/list/allLists", Err: errors.New("tls: failed to verify certificate: x509: certificate signed by unknown authority")}
+)
+
+// newTestRetryFetcher returns a RetryFetcher that records its waits instead of sleeping.
+func newTestRetryFetcher(ury URYFetcher, policy RetryPolicy, waits *[]time.Duration) RetryFetcher {
+	r := NewRetryFetcher(ury, policy)
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+	r.random = func() float64 { return 0.5 }
+	return r
+}
+
+func TestUtils_RetryFetcher(t *testing.T) {
+
+	policy := RetryPolicy{
+		Attempts:     4,
+		InitialDelay: time.Second,
+		MaxDelay:     3 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+		RetryOn:      RetryClasses,
+	}
+
+	ury := &flakyURY{errs: []error{errServer, errNetwork, &url.Error{Op: "Get", Err: timeoutError{}}}}
+	var waits []time.Duration
+	lists, err := newTestRetryFetcher(ury, policy, &waits).GetMailingLists()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || ury.calls != 4 {
+		t.Errorf("Expected the 4th attempt to succeed, got %d calls", ury.calls)
+	}
+	// Doubling from 1s, capped at 3s, less 10% jitter
+	expected := []time.Duration{900 * time.Millisecond, 1800 * time.Millisecond, 2700 * time.Millisecond}
+	if !reflect.DeepEqual(waits, expected) {
+		t.Errorf("Expected waits %v, got %v", expected, waits)
+	}
+
+	ury = &flakyURY{errs: []error{errServer, errServer, errServer, errServer}}
+	waits = nil
+	_, err = newTestRetryFetcher(ury, policy, &waits).GetMailingLists()
+
+	if err == nil || !strings.Contains(err.Error(), "failed after 4 attempts") || !errors.Is(err, errServer) {
+		t.Errorf("Expected to give up after 4 attempts, got '%v'", err)
+	}
+
+	ury = &flakyURY{errs: []error{errNotFound}}
+	waits = nil
+	_, err = newTestRetryFetcher(ury, policy, &waits).GetMailingLists()
+
+	if err != errNotFound || ury.calls != 1 {
+		t.Errorf("Expected a 404 not to be retried, got '%v' after %d calls", err, ury.calls)
+	}
+
+	ury = &flakyURY{errs: []error{errTLS}}
+	waits = nil
+	_, err = newTestRetryFetcher(ury, policy, &waits).GetMailingLists()
+
+	if err != errTLS || ury.calls != 1 {
+		t.Errorf("Expected a certificate error not to be retried, got '%v' after %d calls", err, ury.calls)
+	}
+
+	policy.RetryOn = []string{RetryServerError}
+	ury = &flakyURY{errs: []error{errNetwork}}
+	waits = nil
+	_, err = newTestRetryFetcher(ury, policy, &waits).GetMailingLists()
+
+	if err != errNetwork || ury.calls != 1 {
+		t.Errorf("Expected network errors not to be retried, got '%v' after %d calls", err, ury.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ury = &flakyURY{errs: []error{errServer}}
+	waits = nil
+	_, err = newTestRetryFetcher(ury, policy, &waits).GetMailingListsContext(ctx)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled context to stop retrying, got '%v'", err)
+	}
+
+}
+
+func TestUtils_GetRetryPolicy(t *testing.T) {
+
+	p, err := Config{}.GetRetryPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, DefaultRetryPolicy) {
+		t.Errorf("Expected the default policy, got %+v", p)
+	}
+
+	c := Config{configData: configData{Retry: retryData{
+		Attempts:     5,
+		InitialDelay: "250ms",
+		RetryOn:      []string{"5xx"},
+	}}}
+	p, err = c.GetRetryPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Attempts != 5 || p.InitialDelay != 250*time.Millisecond || p.MaxDelay != DefaultRetryPolicy.MaxDelay ||
+		!reflect.DeepEqual(p.RetryOn, []string{"5xx"}) {
+		t.Errorf("Unexpected policy %+v", p)
+	}
+
+	half, two := 0.5, 2.0
+	invalid := map[string]retryData{
+		"Invalid Retry.Attempts -1, it should be at least 1":                     {Attempts: -1},
+		"Invalid Retry.MaxDelay 'soon', it should be a duration such as \"1s\"":  {MaxDelay: "soon"},
+		"Invalid Retry.Multiplier 0.5, it should be at least 1":                  {Multiplier: &half},
+		"Invalid Retry.Jitter 2, it should be between 0 and 1":                   {Jitter: &two},
+		"Invalid Retry.RetryOn '4xx', it should be one of 5xx, timeout, network": {RetryOn: []string{"4xx"}},
+	}
+
+	for expected, r := range invalid {
+		_, err := Config{configData: configData{Retry: r}}.GetRetryPolicy()
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error '%s', got '%v'", expected, err)
+		}
+	}
+
+	file, cleanup := writeTestConfig(t, `HeadOfStation = "station.manager"
+AssistantHeadOfStation = "assistant.station.manager"
+ApiKey = "hunter2"
+
+[Retry]
+Jitter = 0.0
+`)
+	defer cleanup()
+	c, err = NewConfigFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = c.GetRetryPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Jitter != 0 || p.Multiplier != DefaultRetryPolicy.Multiplier {
+		t.Errorf("Expected Jitter = 0 to turn jitter off, got %+v", p)
+	}
+
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces secrets in errors and logs.
+const Redacted = "[REDACTED]"
+
+// SecretCommandTimeout is how long ApiKeyCommand may run for.
+const SecretCommandTimeout = 30 * time.Second
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+	// apiKeyParam matches the API key in the URLs myradio-go puts in its errors,
+	// so it is hidden even before the key is known.
+	apiKeyParam = regexp.MustCompile(`(api_key=)[^&\s"']+`)
+)
+
+// AddSecret makes Redact hide secret from then on.
+func AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// Redact returns s with every secret added with AddSecret,
+// and any api_key parameter, replaced by Redacted.
+func Redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	secretsMu.RUnlock()
+	return apiKeyParam.ReplaceAllString(s, "${1}"+Redacted)
+}
+
+// redactedError is an error whose message has its secrets redacted.
+// The error it wraps can still be inspected with errors.Is and errors.As.
+type redactedError struct {
+	err error
+}
+
+// RedactError returns err with secrets redacted from its message, or nil if it is nil.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return redactedError{err}
+}
+
+func (e redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactingHandler redacts secrets from the message and attributes of every record.
+type redactingHandler struct {
+	slog.Handler
+}
+
+func (h redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactingHandler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr redacts the value of a, which is only left alone if it can't hold text.
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redacted := make([]any, len(attrs))
+		for i, ga := range attrs {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, Redact(x.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, Redact(x.String()))
+		case []byte:
+			return slog.String(a.Key, Redact(string(x)))
+		}
+		return slog.String(a.Key, Redact(fmt.Sprint(v.Any())))
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// loadApiKey returns the API key from wherever the config says it is, which is
+// ApiKey itself, the environment variable ApiKeyEnv, ApiKeyFile after expanding
+// environment variables such as $CREDENTIALS_DIRECTORY, or the output of ApiKeyCommand.
+// Surrounding whitespace such as a trailing newline is removed.
+// Only one place may be given.
+func (c Config) loadApiKey() (string, error) {
+	d := c.configData
+	var given []string
+	for _, k := range []struct{ name, value string }{
+		{"ApiKey", d.ApiKey},
+		{"ApiKeyEnv", d.ApiKeyEnv},
+		{"ApiKeyFile", d.ApiKeyFile},
+		{"ApiKeyCommand", d.ApiKeyCommand},
+	} {
+		if k.value != "" {
+			given = append(given, k.name)
+		}
+	}
+	if len(given) > 1 {
+		return "", c.keyError(given[1], "Only one of ApiKey, ApiKeyEnv, ApiKeyFile and ApiKeyCommand may be set, got %s", strings.Join(given, " and "))
+	}
+	var key string
+	switch {
+	case d.ApiKeyEnv != "":
+		key = strings.TrimSpace(os.Getenv(d.ApiKeyEnv))
+		if key == "" {
+			return "", c.keyError("ApiKeyEnv", "The environment variable %s, given as ApiKeyEnv, is empty", d.ApiKeyEnv)
+		}
+	case d.ApiKeyFile != "":
+		file := os.ExpandEnv(d.ApiKeyFile)
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", c.keyError("ApiKeyFile", "Unable to read ApiKeyFile: %s", err)
+		}
+		key = strings.TrimSpace(string(b))
+		if key == "" {
+			return "", c.keyError("ApiKeyFile", "ApiKeyFile '%s' is empty", file)
+		}
+	case d.ApiKeyCommand != "":
+		var err error
+		key, err = runSecretCommand(d.ApiKeyCommand)
+		if err != nil {
+			return "", c.keyError("ApiKeyCommand", "%s", err)
+		}
+	default:
+		key = strings.TrimSpace(d.ApiKey)
+	}
+	AddSecret(key)
+	return key, nil
+}
+
+// runSecretCommand runs command with the shell and returns what it printed.
+// Only what it printed to stderr is put in errors, so the secret can't leak into them.
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SecretCommandTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("ApiKeyCommand '%s' timed out after %s", command, SecretCommandTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("ApiKeyCommand '%s' failed, %s: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	key := strings.TrimSpace(stdout.String())
+	if key == "" {
+		return "", fmt.Errorf("ApiKeyCommand '%s' printed nothing", command)
+	}
+	return key, nil
+}
+
+// warnIfReadable warns if the config file at path, which holds the API key
+// itself, can be read by its group or everyone.
+func warnIfReadable(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0044 == 0 {
+		return
+	}
+	slog.Warn("The config file holds the API key and can be read by other users, "+
+		"make it only readable by its owner or use ApiKeyEnv, ApiKeyFile or ApiKeyCommand instead",
+		LogFile, path, "mode", fmt.Sprintf("%04o", info.Mode().Perm()))
+}
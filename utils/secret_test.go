@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUtils_loadApiKey(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "myradio"), []byte("from-a-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ALIASGO_TEST_KEY", "from-the-environment")
+	t.Setenv("ALIASGO_TEST_CREDENTIALS", dir)
+
+	for _, c := range []struct {
+		data     Config
+		expected string
+	}{
+		{Config{configData: configData{ApiKey: "inline"}}, "inline"},
+		{Config{configData: configData{ApiKeyEnv: "ALIASGO_TEST_KEY"}}, "from-the-environment"},
+		{Config{configData: configData{ApiKeyFile: "${ALIASGO_TEST_CREDENTIALS}/myradio"}}, "from-a-file"},
+		{Config{configData: configData{ApiKeyCommand: "echo from-a-command"}}, "from-a-command"},
+	} {
+		actual, err := c.data.loadApiKey()
+		if err != nil || actual != c.expected {
+			t.Errorf("Expected '%s', got '%s' and '%v'", c.expected, actual, err)
+		}
+	}
+
+	for _, c := range []struct {
+		data     Config
+		expected string
+	}{
+		{Config{configData: configData{ApiKey: "inline", ApiKeyFile: "key"}}, "Only one of ApiKey, ApiKeyEnv, ApiKeyFile and ApiKeyCommand may be set, got ApiKey and ApiKeyFile"},
+		{Config{configData: configData{ApiKeyEnv: "ALIASGO_TEST_UNSET"}}, "The environment variable ALIASGO_TEST_UNSET, given as ApiKeyEnv, is empty"},
+		{Config{configData: configData{ApiKeyFile: filepath.Join(dir, "missing")}}, "Unable to read ApiKeyFile"},
+		{Config{configData: configData{ApiKeyCommand: "echo leaked; echo denied >&2; exit 1"}}, "ApiKeyCommand 'echo leaked; echo denied >&2; exit 1' failed, exit status 1: denied"},
+		{Config{configData: configData{ApiKeyCommand: "true"}}, "ApiKeyCommand 'true' printed nothing"},
+	} {
+		_, err := c.data.loadApiKey()
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Errorf("Expected error '%s', got '%v'", c.expected, err)
+		}
+	}
+
+}
+
+func TestUtils_NewConfigFromFile_permissions(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var logged bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	logger, err := NewLogger(&logged, LogFormatText, slog.LevelWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	for _, c := range []struct {
+		config string
+		mode   os.FileMode
+		warned bool
+	}{
+		{"ApiKey = \"inline\"\n", 0644, true},
+		{"ApiKey = \"inline\"\n", 0600, false},
+		{"ApiKeyEnv = \"HOME\"\n", 0644, false},
+	} {
+		logged.Reset()
+		file := filepath.Join(dir, "config.toml")
+		os.Remove(file)
+		config := "HeadOfStation = \"sm\"\nAssistantHeadOfStation = \"asm\"\n" + c.config
+		if err := ioutil.WriteFile(file, []byte(config), c.mode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewConfigFromFile(file); err != nil {
+			t.Fatal(err)
+		}
+		warned := strings.Contains(logged.String(), "can be read by other users")
+		if warned != c.warned {
+			t.Errorf("Expected a warning %t for '%s' with mode %o, got '%s'", c.warned, c.config, c.mode, logged.String())
+		}
+	}
+
+}
+
+func TestUtils_Redact(t *testing.T) {
+
+	AddSecret("hunter2")
+
+	expected := "http://myradio/list?api_key=[REDACTED]&x=1 failed with [REDACTED]"
+	if actual := Redact("http://myradio/list?api_key=abc123&x=1 failed with hunter2"); actual != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, actual)
+	}
+
+	inner := &url.Error{Op: "Get", URL: "http://myradio/list?api_key=hunter2", Err: errors.New("refused")}
+	err := RedactError(inner)
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Expected the key to be redacted, got '%s'", err)
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Error("Expected the redacted error to still be a *url.Error underneath")
+	}
+	if RedactError(nil) != nil {
+		t.Error("Expected a nil error to stay nil")
+	}
+
+	var b bytes.Buffer
+	l, err := NewLogger(&b, LogFormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.With("command", "echo hunter2").Info("Using hunter2", LogError, inner, "group", slog.GroupValue(slog.String("key", "hunter2")))
+	if strings.Contains(b.String(), "hunter2") || !strings.Contains(b.String(), `"msg":"Using [REDACTED]"`) {
+		t.Errorf("Expected the key to be redacted from the log, got '%s'", b.String())
+	}
+
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/UniversityRadioYork/myradio-go"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Snapshot holds every response from MyRadio that the aliases are generated from,
+// so they can be generated again when MyRadio is unreachable.
+type Snapshot struct {
+	// Taken is when the responses were fetched.
+	Taken            time.Time
+	Lists            []myradio.List
+	ListMembers      map[int][]myradio.User
+	MiscAliases      []myradio.Alias
+	OfficerPositions []myradio.OfficerPosition
+	MemberAliases    []myradio.UserAlias
+	TeamHeads        map[uint64][]myradio.Officer
+}
+
+// NewSnapshot returns an empty snapshot taken at taken.
+func NewSnapshot(taken time.Time) *Snapshot {
+	return &Snapshot{
+		Taken:       taken,
+		ListMembers: make(map[int][]myradio.User),
+		TeamHeads:   make(map[uint64][]myradio.Officer),
+	}
+}
+
+// ReadSnapshotFile reads a snapshot written by WriteSnapshotFile.
+func ReadSnapshotFile(file string) (*Snapshot, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSnapshot(time.Time{})
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("Invalid snapshot '%s': %s", file, err)
+	}
+	return s, nil
+}
+
+// WriteSnapshotFile replaces file with the snapshot, in the same way as the aliases file.
+// Only its owner may read it, as it holds members' details.
+func WriteSnapshotFile(s *Snapshot, file string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, b, WriteOptions{Mode: 0600})
+}
+
+// SnapshotReporter is a fetcher which may answer from a snapshot rather than MyRadio.
+type SnapshotReporter interface {
+	// UsedSnapshot returns when the snapshot was taken
+	// and whether any call has been answered from it.
+	UsedSnapshot() (time.Time, bool)
+}
+
+// SnapshotFetcher records every response of another fetcher in a snapshot.
+// When a call fails it is answered from the last snapshot instead,
+// as long as that is no older than its maximum age.
+type SnapshotFetcher struct {
+	fetcher URYFetcherContext
+	last    *Snapshot
+	maxAge  time.Duration
+
+	mu       sync.Mutex
+	recorded *Snapshot
+	used     bool
+}
+
+// NewSnapshotFetcher wraps f, falling back to last, if it isn't nil, when a call fails.
+// A maxAge of 0 allows a snapshot of any age.
+func NewSnapshotFetcher(f URYFetcher, last *Snapshot, maxAge time.Duration) *SnapshotFetcher {
+	return &SnapshotFetcher{
+		fetcher:  ContextFetcher(f),
+		last:     last,
+		maxAge:   maxAge,
+		recorded: NewSnapshot(time.Now()),
+	}
+}
+
+// Recorded returns the snapshot of every response so far,
+// or nil if any of them came from the last snapshot.
+func (s *SnapshotFetcher) Recorded() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used {
+		return nil
+	}
+	return s.recorded
+}
+
+// UsedSnapshot returns when the last snapshot was taken
+// and whether any call has been answered from it.
+func (s *SnapshotFetcher) UsedSnapshot() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.used {
+		return time.Time{}, false
+	}
+	return s.last.Taken, true
+}
+
+// fetch calls live, recording its response with record if it succeeds.
+// If it fails, cached answers from the last snapshot instead, returning false
+// if the snapshot has no record of it. Snapshots are only saved whole,
+// so only the members of lists and heads of teams can be missing.
+// Once one call has been answered from the snapshot MyRadio is assumed
+// to be unreachable, so the rest are answered from it straight away.
+func (s *SnapshotFetcher) fetch(ctx context.Context, name string, live func() error, record func(), cached func() bool) error {
+	s.mu.Lock()
+	used := s.used
+	s.mu.Unlock()
+	if used && cached() {
+		return nil
+	}
+	err := live()
+	if err == nil {
+		s.mu.Lock()
+		record()
+		s.mu.Unlock()
+		return nil
+	}
+	if ctx.Err() != nil || s.last == nil {
+		// Giving up on purpose isn't MyRadio being unreachable
+		return err
+	}
+	if age := time.Since(s.last.Taken); s.maxAge > 0 && age > s.maxAge {
+		return fmt.Errorf("%s (the snapshot taken %s is too old to use, it is %s old and SnapshotMaxAge is %s)",
+			err, s.last.Taken.Format(time.RFC3339), age.Round(time.Second), s.maxAge)
+	}
+	if !cached() {
+		return fmt.Errorf("%s (the snapshot taken %s has nothing for %s)", err, s.last.Taken.Format(time.RFC3339), name)
+	}
+	s.mu.Lock()
+	s.used = true
+	s.mu.Unlock()
+	Logger(ctx).Warn("MyRadio failed, using the snapshot instead", "call", name, "taken", s.last.Taken, LogError, err)
+	return nil
+}
+
+func (s *SnapshotFetcher) GetMailingListsContext(ctx context.Context) (lists []myradio.List, err error) {
+	err = s.fetch(ctx, "fetching the mailing lists",
+		func() (err error) {
+			lists, err = s.fetcher.GetMailingListsContext(ctx)
+			return
+		},
+		func() { s.recorded.Lists = lists },
+		func() bool {
+			lists = s.last.Lists
+			return true
+		})
+	return
+}
+
+func (s *SnapshotFetcher) GetMailingListMembersContext(ctx context.Context, list myradio.List) (members []myradio.User, err error) {
+	err = s.fetch(ctx, fmt.Sprintf("fetching the members of list '%s'", list.Name),
+		func() (err error) {
+			members, err = s.fetcher.GetMailingListMembersContext(ctx, list)
+			return
+		},
+		func() { s.recorded.ListMembers[list.Listid] = members },
+		func() (ok bool) {
+			members, ok = s.last.ListMembers[list.Listid]
+			return
+		})
+	return
+}
+
+func (s *SnapshotFetcher) GetMiscAliasesContext(ctx context.Context) (aliases []myradio.Alias, err error) {
+	err = s.fetch(ctx, "fetching the misc aliases",
+		func() (err error) {
+			aliases, err = s.fetcher.GetMiscAliasesContext(ctx)
+			return
+		},
+		func() { s.recorded.MiscAliases = aliases },
+		func() bool {
+			aliases = s.last.MiscAliases
+			return true
+		})
+	return
+}
+
+func (s *SnapshotFetcher) GetOfficerAliasesContext(ctx context.Context) (officers []myradio.OfficerPosition, err error) {
+	err = s.fetch(ctx, "fetching the officer positions",
+		func() (err error) {
+			officers, err = s.fetcher.GetOfficerAliasesContext(ctx)
+			return
+		},
+		func() { s.recorded.OfficerPositions = officers },
+		func() bool {
+			officers = s.last.OfficerPositions
+			return true
+		})
+	return
+}
+
+func (s *SnapshotFetcher) GetMemberAliasesContext(ctx context.Context) (aliases []myradio.UserAlias, err error) {
+	err = s.fetch(ctx, "fetching the member aliases",
+		func() (err error) {
+			aliases, err = s.fetcher.GetMemberAliasesContext(ctx)
+			return
+		},
+		func() { s.recorded.MemberAliases = aliases },
+		func() bool {
+			aliases = s.last.MemberAliases
+			return true
+		})
+	return
+}
+
+func (s *SnapshotFetcher) GetHeadOfTeamContext(ctx context.Context, t myradio.Team) (heads []myradio.Officer, err error) {
+	err = s.fetch(ctx, fmt.Sprintf("fetching the head of team '%s'", t.Name),
+		func() (err error) {
+			heads, err = s.fetcher.GetHeadOfTeamContext(ctx, t)
+			return
+		},
+		func() { s.recorded.TeamHeads[t.TeamID] = heads },
+		func() (ok bool) {
+			heads, ok = s.last.TeamHeads[t.TeamID]
+			return
+		})
+	return
+}
+
+func (s *SnapshotFetcher) GetMailingLists() ([]myradio.List, error) {
+	return s.GetMailingListsContext(context.Background())
+}
+
+func (s *SnapshotFetcher) GetMailingListMembers(list myradio.List) ([]myradio.User, error) {
+	return s.GetMailingListMembersContext(context.Background(), list)
+}
+
+func (s *SnapshotFetcher) GetMiscAliases() ([]myradio.Alias, error) {
+	return s.GetMiscAliasesContext(context.Background())
+}
+
+func (s *SnapshotFetcher) GetOfficerAliases() ([]myradio.OfficerPosition, error) {
+	return s.GetOfficerAliasesContext(context.Background())
+}
+
+func (s *SnapshotFetcher) GetMemberAliases() ([]myradio.UserAlias, error) {
+	return s.GetMemberAliasesContext(context.Background())
+}
+
+func (s *SnapshotFetcher) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
+	return s.GetHeadOfTeamContext(context.Background(), t)
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"errors"
+	"github.com/UniversityRadioYork/myradio-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotURY answers every call, or fails every call if down is set.
+type snapshotURY struct {
+	down bool
+}
+
+var errDown = errors.New("https://ury.org.uk/api/v2/list/allLists not ok: 502 Bad Gateway")
+
+func (ury snapshotURY) GetMailingLists() ([]myradio.List, error) {
+	if ury.down {
+		return nil, errDown
+	}
+	return []myradio.List{{Listid: 1, Name: "Computing", Address: "computing"}}, nil
+}
+
+func (ury snapshotURY) GetMailingListMembers(list myradio.List) ([]myradio.User, error) {
+	if ury.down {
+		return nil, errDown
+	}
+	return []myradio.User{{MemberID: 1, Email: "someone@example.com", Receiveemail: true}}, nil
+}
+
+func (ury snapshotURY) GetMiscAliases() ([]myradio.Alias, error) {
+	if ury.down {
+		return nil, errDown
+	}
+	return []myradio.Alias{}, nil
+}
+
+func (ury snapshotURY) GetOfficerAliases() ([]myradio.OfficerPosition, error) {
+	if ury.down {
+		return nil, errDown
+	}
+	return []myradio.OfficerPosition{{OfficerID: 1, Alias: "head.of.computing", Team: myradio.Team{TeamID: 2}}}, nil
+}
+
+func (ury snapshotURY) GetMemberAliases() ([]myradio.UserAlias, error) {
+	if ury.down {
+		return nil, errDown
+	}
+	return []myradio.UserAlias{{Source: "someone", Destination: "someone@example.com"}}, nil
+}
+
+func (ury snapshotURY) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
+	if ury.down {
+		return nil, errDown
+	}
+	return []myradio.Officer{{User: myradio.User{MemberID: 2, Email: "head@example.com"}}}, nil
+}
+
+func TestUtils_SnapshotFetcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	live := NewSnapshotFetcher(snapshotURY{}, nil, time.Hour)
+	lists, _ := live.GetMailingLists()
+	members, _ := live.GetMailingListMembers(lists[0])
+	officers, _ := live.GetOfficerAliases()
+	heads, _ := live.GetHeadOfTeam(officers[0].Team)
+	userAliases, _ := live.GetMemberAliases()
+	if _, err := live.GetMiscAliases(); err != nil {
+		t.Fatal(err)
+	}
+	if _, used := live.UsedSnapshot(); used {
+		t.Error("Expected the snapshot not to be used while MyRadio is up")
+	}
+
+	err = WriteSnapshotFile(live.Recorded(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+	last, err := ReadSnapshotFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	down := NewSnapshotFetcher(snapshotURY{down: true}, last, time.Hour)
+	actualLists, err := down.GetMailingLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actualMembers, _ := down.GetMailingListMembers(actualLists[0])
+	actualOfficers, _ := down.GetOfficerAliases()
+	actualHeads, _ := down.GetHeadOfTeam(actualOfficers[0].Team)
+	actualUserAliases, _ := down.GetMemberAliases()
+
+	for _, pair := range [][2]interface{}{
+		{lists, actualLists},
+		{members, actualMembers},
+		{officers, actualOfficers},
+		{heads, actualHeads},
+		{userAliases, actualUserAliases},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Errorf("Expected %+v from the snapshot, got %+v", pair[0], pair[1])
+		}
+	}
+	if taken, used := down.UsedSnapshot(); !used || !taken.Equal(last.Taken) {
+		t.Errorf("Expected the snapshot taken %s to be used, got %s", last.Taken, taken)
+	}
+	if down.Recorded() != nil {
+		t.Error("Expected nothing to be recorded once the snapshot is used")
+	}
+
+	_, err = down.GetHeadOfTeam(myradio.Team{TeamID: 3, Name: "New"})
+	if err == nil || !strings.Contains(err.Error(), "has nothing for fetching the head of team 'New'") {
+		t.Errorf("Expected the snapshot to have nothing for a new team, got '%v'", err)
+	}
+
+	last.Taken = time.Now().Add(-2 * time.Hour)
+	_, err = NewSnapshotFetcher(snapshotURY{down: true}, last, time.Hour).GetMailingLists()
+	if err == nil || !strings.Contains(err.Error(), "too old to use") {
+		t.Errorf("Expected the snapshot to be too old, got '%v'", err)
+	}
+
+	_, err = NewSnapshotFetcher(snapshotURY{down: true}, nil, time.Hour).GetMailingLists()
+	if err != errDown {
+		t.Errorf("Expected the error from MyRadio without a snapshot, got '%v'", err)
+	}
+
+}
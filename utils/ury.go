@@ -1,6 +1,11 @@
 package utils
 
-import "github.com/UniversityRadioYork/myradio-go"
+import (
+	"context"
+	"fmt"
+	"github.com/UniversityRadioYork/myradio-go"
+	"sync/atomic"
+)
 
 type URYFetcher interface {
 	GetMailingLists() ([]myradio.List, error)
@@ -11,6 +16,151 @@ type URYFetcher interface {
 	GetHeadOfTeam(myradio.Team) ([]myradio.Officer, error)
 }
 
+// URYFetcherContext is a URYFetcher whose calls give up,
+// returning the context's error, once their context is done.
+type URYFetcherContext interface {
+	GetMailingListsContext(ctx context.Context) ([]myradio.List, error)
+	GetMailingListMembersContext(ctx context.Context, list myradio.List) ([]myradio.User, error)
+	GetMiscAliasesContext(ctx context.Context) ([]myradio.Alias, error)
+	GetOfficerAliasesContext(ctx context.Context) ([]myradio.OfficerPosition, error)
+	GetMemberAliasesContext(ctx context.Context) ([]myradio.UserAlias, error)
+	GetHeadOfTeamContext(ctx context.Context, t myradio.Team) ([]myradio.Officer, error)
+}
+
+// MaxAbandonedCalls is how many calls to MyRadio may be carrying on in the background
+// after being abandoned. myradio-go can't be cancelled and waits for MyRadio without
+// a timeout, so each abandoned call holds a goroutine and a connection until MyRadio
+// answers. Once this many are outstanding, as when MyRadio has hung, new calls fail
+// straight away rather than piling up more on every timed out run.
+const MaxAbandonedCalls = 32
+
+// abandoned counts the calls to MyRadio abandoned by withContext that are still running.
+var abandoned atomic.Int64
+
+// AbandonedCalls returns how many calls to MyRadio are carrying on in the background
+// after their context was done.
+func AbandonedCalls() int {
+	return int(abandoned.Load())
+}
+
+// ContextFetcher returns f as a URYFetcherContext.
+// If f doesn't support contexts itself, its calls are abandoned
+// once their context is done, although they carry on in the background,
+// up to MaxAbandonedCalls of them.
+func ContextFetcher(f URYFetcher) URYFetcherContext {
+	if fc, ok := f.(URYFetcherContext); ok {
+		return fc
+	}
+	return contextFetcher{f}
+}
+
+// withContext runs call, returning early with the context's error
+// if the context is done first.
+// call must not be relied on to have finished if an error is returned.
+// It fails without running call if MaxAbandonedCalls are still running.
+func withContext(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n := abandoned.Load(); n >= MaxAbandonedCalls {
+		return fmt.Errorf("%d abandoned calls to MyRadio are still running, it may have hung", n)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		n := abandoned.Add(1)
+		Logger(ctx).Warn("Abandoning a call to MyRadio, which carries on in the background",
+			"abandoned", n, "max_abandoned", MaxAbandonedCalls)
+		go func() {
+			<-done
+			abandoned.Add(-1)
+		}()
+		return ctx.Err()
+	}
+}
+
+type contextFetcher struct {
+	fetcher URYFetcher
+}
+
+func (f contextFetcher) GetMailingListsContext(ctx context.Context) ([]myradio.List, error) {
+	var lists []myradio.List
+	err := withContext(ctx, func() (err error) {
+		lists, err = f.fetcher.GetMailingLists()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (f contextFetcher) GetMailingListMembersContext(ctx context.Context, list myradio.List) ([]myradio.User, error) {
+	var members []myradio.User
+	err := withContext(ctx, func() (err error) {
+		members, err = f.fetcher.GetMailingListMembers(list)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (f contextFetcher) GetMiscAliasesContext(ctx context.Context) ([]myradio.Alias, error) {
+	var aliases []myradio.Alias
+	err := withContext(ctx, func() (err error) {
+		aliases, err = f.fetcher.GetMiscAliases()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (f contextFetcher) GetOfficerAliasesContext(ctx context.Context) ([]myradio.OfficerPosition, error) {
+	var officers []myradio.OfficerPosition
+	err := withContext(ctx, func() (err error) {
+		officers, err = f.fetcher.GetOfficerAliases()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return officers, nil
+}
+
+func (f contextFetcher) GetMemberAliasesContext(ctx context.Context) ([]myradio.UserAlias, error) {
+	var aliases []myradio.UserAlias
+	err := withContext(ctx, func() (err error) {
+		aliases, err = f.fetcher.GetMemberAliases()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (f contextFetcher) GetHeadOfTeamContext(ctx context.Context, t myradio.Team) ([]myradio.Officer, error) {
+	var heads []myradio.Officer
+	err := withContext(ctx, func() (err error) {
+		heads, err = f.fetcher.GetHeadOfTeam(t)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
+
+// URY fetches from MyRadio, redacting the API key from its errors.
 type URY struct {
 	URYFetcher
 	session myradio.Session
@@ -25,26 +175,43 @@ func NewURY(apikey string) (u URY, err error) {
 	return
 }
 
+// NewURYForServer is NewURY for the MyRadio API at server,
+// such as "https://ury.org.uk/api/v2".
+func NewURYForServer(apikey, server string) (u URY, err error) {
+	s, err := myradio.NewSessionForServer(apikey, server)
+	if err != nil {
+		return
+	}
+	u = URY{session: *s}
+	return
+}
+
 func (u URY) GetMailingLists() ([]myradio.List, error) {
-	return u.session.GetAllLists()
+	lists, err := u.session.GetAllLists()
+	return lists, RedactError(err)
 }
 
 func (u URY) GetMailingListMembers(list myradio.List) ([]myradio.User, error) {
-	return u.session.GetUsers(&list)
+	members, err := u.session.GetUsers(&list)
+	return members, RedactError(err)
 }
 
 func (u URY) GetMiscAliases() ([]myradio.Alias, error) {
-	return u.session.GetAllAliases([]string{})
+	aliases, err := u.session.GetAllAliases([]string{})
+	return aliases, RedactError(err)
 }
 
 func (u URY) GetOfficerAliases() ([]myradio.OfficerPosition, error) {
-	return u.session.GetAllOfficerPositions([]string{"history", "current"})
+	officers, err := u.session.GetAllOfficerPositions([]string{"history", "current"})
+	return officers, RedactError(err)
 }
 
 func (u URY) GetMemberAliases() ([]myradio.UserAlias, error) {
-	return u.session.GetUserAliases()
+	aliases, err := u.session.GetUserAliases()
+	return aliases, RedactError(err)
 }
 
 func (u URY) GetHeadOfTeam(t myradio.Team) ([]myradio.Officer, error) {
-	return u.session.GetTeamHeadPositions(int(t.TeamID), []string{})
+	heads, err := u.session.GetTeamHeadPositions(int(t.TeamID), []string{})
+	return heads, RedactError(err)
 }
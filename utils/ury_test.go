@@ -0,0 +1,131 @@
+package utils_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/UniversityRadioYork/alias-go/myradiotest"
+	"github.com/UniversityRadioYork/alias-go/utils"
+	"github.com/UniversityRadioYork/myradio-go"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUtils_URY(t *testing.T) {
+
+	fixture := myradiotest.Fixture()
+	server := myradiotest.NewServer(fixture)
+	defer server.Close()
+	server.APIKey = "secret"
+
+	ury, err := utils.NewURYForServer("secret", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lists, err := ury.GetMailingLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lists, fixture.Lists) {
+		t.Errorf("Expected lists %+v, got %+v", fixture.Lists, lists)
+	}
+	members, err := ury.GetMailingListMembers(lists[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members, fixture.ListMembers[1]) {
+		t.Errorf("Expected members %+v, got %+v", fixture.ListMembers[1], members)
+	}
+	officers, err := ury.GetOfficerAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	heads, err := ury.GetHeadOfTeam(officers[1].Team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heads) != 1 || heads[0].User.Email != "sam@example.com" {
+		t.Errorf("Expected Sam to head the team, got %+v", heads)
+	}
+	aliases, err := ury.GetMiscAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || len(aliases[0].Destinations) != 2 {
+		t.Errorf("Expected the webmaster alias, got %+v", aliases)
+	}
+	if _, err := ury.GetMemberAliases(); err != nil {
+		t.Fatal(err)
+	}
+
+	wrongKey, _ := utils.NewURYForServer("wrong", server.URL)
+	if _, err := wrongKey.GetMailingLists(); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the wrong API key to be refused, got '%v'", err)
+	}
+
+	server.Fail(fmt.Sprintf(myradiotest.EndpointListMembers, 1), myradiotest.Fault{Status: 500, Times: 1})
+	if _, err := ury.GetMailingListMembers(lists[0]); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Expected a 500, got '%v'", err)
+	}
+	if _, err := ury.GetMailingListMembers(lists[0]); err != nil {
+		t.Errorf("Expected the fault to have cleared, got '%v'", err)
+	}
+
+	server.Fail(myradiotest.EndpointLists, myradiotest.Fault{Malformed: true})
+	if _, err := ury.GetMailingLists(); err == nil {
+		t.Error("Expected malformed JSON to fail")
+	}
+
+	server.Fail(myradiotest.EndpointUserAliases, myradiotest.Fault{Latency: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := utils.ContextFetcher(ury).GetMemberAliasesContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected a slow response to time out, got '%v'", err)
+	}
+
+}
+
+// hungURY never answers a call to fetch the member aliases until it is released.
+type hungURY struct {
+	utils.URYFetcher
+	release chan struct{}
+}
+
+func (ury hungURY) GetMemberAliases() ([]myradio.UserAlias, error) {
+	<-ury.release
+	return nil, nil
+}
+
+func TestUtils_ContextFetcher_abandoned(t *testing.T) {
+
+	ury := hungURY{release: make(chan struct{})}
+	f := utils.ContextFetcher(ury)
+
+	for utils.AbandonedCalls() < utils.MaxAbandonedCalls {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if _, err := f.GetMemberAliasesContext(ctx); err != context.DeadlineExceeded {
+			t.Fatalf("Expected the hung call to time out, got '%v'", err)
+		}
+		cancel()
+	}
+
+	_, err := f.GetMemberAliasesContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "abandoned calls to MyRadio are still running") {
+		t.Errorf("Expected no more calls once too many were abandoned, got '%v'", err)
+	}
+
+	close(ury.release)
+	deadline := time.Now().Add(10 * time.Second)
+	for utils.AbandonedCalls() >= utils.MaxAbandonedCalls {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the abandoned calls to be counted off as they finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := f.GetMemberAliasesContext(context.Background()); err != nil {
+		t.Errorf("Expected calls to be made again once the abandoned ones finished, got '%v'", err)
+	}
+
+}
@@ -0,0 +1,357 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ConfigError is a problem with a key in a config file, on Line of File if they are known.
+type ConfigError struct {
+	File    string
+	Line    int
+	Key     string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return e.Message
+}
+
+// ConfigErrors holds every problem found with a config file, in the order of their lines.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// keyError returns an error about key, on the line of the config file it was set on,
+// or the line its section starts on if it wasn't set.
+func (c Config) keyError(key, format string, args ...interface{}) error {
+	line := 0
+	for k := key; line == 0 && k != ""; {
+		line = c.lines[k]
+		i := strings.LastIndex(k, ".")
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	return &ConfigError{File: c.file, Line: line, Key: key, Message: fmt.Sprintf(format, args...)}
+}
+
+// asConfigError returns err as a ConfigError, about no key in particular if it isn't one already.
+func (c Config) asConfigError(err error) *ConfigError {
+	var ce *ConfigError
+	if errors.As(err, &ce) {
+		return ce
+	}
+	return &ConfigError{File: c.file, Message: err.Error()}
+}
+
+// Line returns the line of the config file key was set on, or 0 if it wasn't.
+// Keys in a section are written as "Section.Key", and those in the nth
+// of an array of tables as "Section[n].Key", counting from 0.
+func (c Config) Line(key string) int {
+	return c.lines[key]
+}
+
+var (
+	tableLine = regexp.MustCompile(`^\s*(\[\[?)\s*([A-Za-z0-9_.-]+)\s*\]`)
+	keyLine   = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+(?:\s*\.\s*[A-Za-z0-9_-]+)*)\s*=`)
+)
+
+// keyLines returns the line each key, and each section, is first set on in src.
+// Keys in an array of tables are found both as "Section[n].Key" and, for the
+// first table they are in, as "Section.Key".
+// Only bare keys are found, which is all the config uses.
+func keyLines(src string) map[string]int {
+	lines := make(map[string]int)
+	set := func(key string, line int) {
+		if _, seen := lines[key]; !seen {
+			lines[key] = line
+		}
+	}
+	// table is the section keys are in and tables counts each array of tables
+	var table, array string
+	tables := make(map[string]int)
+	for i, line := range strings.Split(src, "\n") {
+		if m := tableLine.FindStringSubmatch(line); m != nil {
+			table, array = m[2], ""
+			if m[1] == "[[" {
+				array = table
+				table = fmt.Sprintf("%s[%d]", array, tables[array])
+				tables[array]++
+				set(array, i+1)
+			}
+			set(table, i+1)
+		} else if m := keyLine.FindStringSubmatch(line); m != nil {
+			key := strings.Join(strings.Fields(m[1]), "")
+			if table == "" {
+				set(key, i+1)
+				continue
+			}
+			set(table+"."+key, i+1)
+			if array != "" {
+				set(array+"."+key, i+1)
+			}
+		}
+	}
+	return lines
+}
+
+// knownKeys returns every key the config can have, with the keys in a section as "Section.Key".
+func knownKeys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Name
+			if tag := strings.Split(f.Tag.Get("toml"), ",")[0]; tag != "" {
+				name = tag
+			}
+			keys = append(keys, prefix+name)
+			ft := f.Type
+			if ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				walk(ft, prefix+name+".")
+			}
+		}
+	}
+	walk(reflect.TypeOf(configData{}), "")
+	return keys
+}
+
+// unknownKeys returns an error for each key that was in the config file but
+// isn't one the config has, such as a misspelt one, suggesting the key it might be.
+// Keys in an unknown section are only reported as the section.
+func (c Config) unknownKeys(undecoded []toml.Key) []*ConfigError {
+	unknown := make(map[string]bool)
+	for _, k := range undecoded {
+		unknown[k.String()] = true
+	}
+	known := knownKeys()
+	var errs []*ConfigError
+	for _, k := range undecoded {
+		if len(k) > 1 && unknown[k[:len(k)-1].String()] {
+			continue
+		}
+		message := fmt.Sprintf("Unknown key '%s'", k)
+		if suggestion := closestKey(k.String(), known); suggestion != "" {
+			message += fmt.Sprintf(", did you mean '%s'?", suggestion)
+		}
+		errs = append(errs, c.keyError(k.String(), "%s", message).(*ConfigError))
+	}
+	return errs
+}
+
+// closestKey returns the key in known that key is most likely a misspelling of, or "" if none is close.
+func closestKey(key string, known []string) string {
+	best, bestDistance := "", 3
+	for _, k := range known {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(k)); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of single character insertions, deletions,
+// substitutions and transpositions needed to turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// Validate checks every value in the config, returning ConfigErrors
+// naming the line of each one that is invalid, or nil if they all are.
+// The API key must already have been loaded.
+func (c Config) Validate() error {
+	var errs ConfigErrors
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, c.asConfigError(err))
+		}
+	}
+	d := c.configData
+	if d.HeadOfStation == "" {
+		check(c.keyError("HeadOfStation", "HeadOfStation is required"))
+	}
+	if d.AssistantHeadOfStation == "" {
+		check(c.keyError("AssistantHeadOfStation", "AssistantHeadOfStation is required"))
+	}
+	if d.ApiKey == "" {
+		check(c.keyError("ApiKey", "No API key is set, set one of ApiKey, ApiKeyEnv, ApiKeyFile or ApiKeyCommand"))
+	}
+	if d.ApiBaseURL != "" {
+		u, err := url.Parse(d.ApiBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			check(c.keyError("ApiBaseURL", "Invalid ApiBaseURL '%s', it should be a URL such as \"https://ury.org.uk/api/v2\"", d.ApiBaseURL))
+		}
+	}
+	if d.StandDownPeriod < 0 {
+		check(c.keyError("StandDownPeriod", "Invalid StandDownPeriod %d, it should be a number of days, at least 0", d.StandDownPeriod))
+	}
+	switch d.DanglingPolicy {
+	case "", "warn", "drop", "fail":
+	default:
+		check(c.keyError("DanglingPolicy", "Invalid DanglingPolicy '%s', it should be warn, drop or fail", d.DanglingPolicy))
+	}
+	if d.Concurrency < 0 {
+		check(c.keyError("Concurrency", "Invalid Concurrency %d, it should be at least 1, or 0 for the default", d.Concurrency))
+	}
+	if d.Backups < 0 {
+		check(c.keyError("Backups", "Invalid Backups %d, it should be at least 0", d.Backups))
+	}
+	_, err := c.GetWriteOptions()
+	check(err)
+	_, err = c.GetInterval()
+	check(err)
+	_, err = c.GetSnapshotOptions()
+	check(err)
+	if d.Safety.MaxRemovedPercent < 0 || d.Safety.MaxRemovedPercent > 100 {
+		check(c.keyError("Safety.MaxRemovedPercent", "Invalid Safety.MaxRemovedPercent %g, it should be between 0 and 100", d.Safety.MaxRemovedPercent))
+	}
+	if d.Safety.MaxRemovedRecipients < 0 {
+		check(c.keyError("Safety.MaxRemovedRecipients", "Invalid Safety.MaxRemovedRecipients %d, it should be at least 0", d.Safety.MaxRemovedRecipients))
+	}
+	if d.Serve.Listen != "" {
+		if _, _, err := net.SplitHostPort(d.Serve.Listen); err != nil {
+			check(c.keyError("Serve.Listen", "Invalid Serve.Listen '%s', it should be an address such as \"127.0.0.1:8025\"", d.Serve.Listen))
+		}
+	}
+	_, err = c.GetHooks()
+	check(err)
+	_, err = c.GetRetryPolicy()
+	check(err)
+	for i, a := range d.Aliases {
+		key := fmt.Sprintf("alias[%d]", i)
+		if strings.TrimSpace(a.Source) == "" {
+			check(c.keyError(key+".source", "Alias %d has no source", i+1))
+		} else if strings.ContainsAny(a.Source, " \t\r\n,:") {
+			check(c.keyError(key+".source", "Invalid alias source '%s', it can't contain spaces, commas or colons", a.Source))
+		}
+		if len(a.Destinations) == 0 {
+			check(c.keyError(key+".destinations", "Alias '%s' has no destinations", a.Source))
+		}
+		for _, dest := range a.Destinations {
+			if strings.TrimSpace(dest) == "" {
+				check(c.keyError(key+".destinations", "Alias '%s' has a blank destination", a.Source))
+			}
+		}
+		switch a.Mode {
+		case "", StaticAppend, StaticReplace:
+		default:
+			check(c.keyError(key+".mode", "Invalid mode '%s' for alias '%s', it should be append or replace", a.Mode, a.Source))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	errs.Sort()
+	return errs
+}
+
+// Sort puts the errors in the order of their lines, with those without a line last.
+func (e ConfigErrors) Sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if (e[i].Line == 0) != (e[j].Line == 0) {
+			return e[j].Line == 0
+		}
+		return e[i].Line < e[j].Line
+	})
+}
+
+// WriteEffective writes the config as alias-go uses it to w in TOML, with
+// the defaults filled in for anything the config doesn't say and secrets redacted.
+// format is the format the aliases are written in, which the command line may override.
+func (c Config) WriteEffective(w io.Writer, format string) error {
+	d := c.configData
+	if d.ApiKey != "" {
+		d.ApiKey = Redacted
+	}
+	d.Format = format
+	if d.DanglingPolicy == "" {
+		d.DanglingPolicy = "warn"
+	}
+	if d.Concurrency == 0 {
+		d.Concurrency = DefaultConcurrency
+	}
+	o, err := c.GetWriteOptions()
+	if err != nil {
+		return err
+	}
+	d.FileMode = fmt.Sprintf("%04o", o.Mode)
+	interval, err := c.GetInterval()
+	if err != nil {
+		return err
+	}
+	d.Interval = interval.String()
+	s, err := c.GetSnapshotOptions()
+	if err != nil {
+		return err
+	}
+	d.SnapshotMaxAge = s.MaxAge.String()
+	d.Serve = c.GetServeOptions()
+	if d.Serve.Token != "" {
+		d.Serve.Token = Redacted
+	}
+	h, err := c.GetHooks()
+	if err != nil {
+		return err
+	}
+	d.Hooks.Timeout = h.Timeout.String()
+	p, err := c.GetRetryPolicy()
+	if err != nil {
+		return err
+	}
+	d.Aliases = c.GetStaticAliases()
+	d.Retry = retryData{
+		Attempts:     p.Attempts,
+		InitialDelay: p.InitialDelay.String(),
+		MaxDelay:     p.MaxDelay.String(),
+		Multiplier:   &p.Multiplier,
+		Jitter:       &p.Jitter,
+		RetryOn:      p.RetryOn,
+	}
+	return toml.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, config string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestUtils_NewConfigFromFile_strict(t *testing.T) {
+
+	file, cleanup := writeTestConfig(t, `HeadOfStation = "station.manager"
+AssistantHeadOfStation = "assistant.station.manager"
+ApiKey = "key"
+StandDownPeroid = 28
+Backups = -1
+Interval = "often"
+
+[Safety]
+MaxRemovedPercent = 110.0
+
+[Saftey]
+MaxRemovedRecipients = 5
+
+[Retry]
+Multiplier = 0.5
+`)
+	defer cleanup()
+
+	_, err := NewConfigFromFile(file)
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ConfigErrors, got '%v'", err)
+	}
+	expected := []string{
+		file + ":4: Unknown key 'StandDownPeroid', did you mean 'StandDownPeriod'?",
+		file + ":5: Invalid Backups -1, it should be at least 0",
+		file + ":6: Invalid Interval 'often', it should be a duration such as \"15m\"",
+		file + ":9: Invalid Safety.MaxRemovedPercent 110, it should be between 0 and 100",
+		file + ":11: Unknown key 'Saftey', did you mean 'Safety'?",
+		file + ":15: Invalid Retry.Multiplier 0.5, it should be at least 1",
+	}
+	if err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("Expected errors \n%s\ngot \n%s", strings.Join(expected, "\n"), err)
+	}
+	if errs[0].Key != "StandDownPeroid" || errs[0].Line != 4 {
+		t.Errorf("Expected the first error to be about StandDownPeroid on line 4, got %+v", errs[0])
+	}
+
+	file, cleanup = writeTestConfig(t, "StandDownPeriod = -1\n")
+	defer cleanup()
+	_, err = NewConfigFromFile(file)
+	expectedErr := file + ":1: Invalid StandDownPeriod -1, it should be a number of days, at least 0\n" +
+		file + ": HeadOfStation is required\n" +
+		file + ": AssistantHeadOfStation is required\n" +
+		file + ": No API key is set, set one of ApiKey, ApiKeyEnv, ApiKeyFile or ApiKeyCommand"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("Expected errors \n%s\ngot \n%v", expectedErr, err)
+	}
+
+}
+
+func TestUtils_NewConfigFromFile_staticAliases(t *testing.T) {
+
+	file, cleanup := writeTestConfig(t, `HeadOfStation = "station.manager"
+AssistantHeadOfStation = "assistant.station.manager"
+ApiKey = "key"
+
+[[alias]]
+source = "postmaster"
+destinations = ["root"]
+
+[[alias]]
+source = "head of computing"
+destinations = []
+mode = "overwrite"
+
+[[alias]]
+destinations = ["root"]
+destination = "root"
+`)
+	defer cleanup()
+
+	_, err := NewConfigFromFile(file)
+	expected := []string{
+		file + ":10: Invalid alias source 'head of computing', it can't contain spaces, commas or colons",
+		file + ":11: Alias 'head of computing' has no destinations",
+		file + ":12: Invalid mode 'overwrite' for alias 'head of computing', it should be append or replace",
+		file + ":14: Alias 3 has no source",
+		file + ":16: Unknown key 'alias.destination', did you mean 'alias.destinations'?",
+	}
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("Expected errors \n%s\ngot \n%v", strings.Join(expected, "\n"), err)
+	}
+
+	file, cleanup = writeTestConfig(t, `HeadOfStation = "station.manager"
+AssistantHeadOfStation = "assistant.station.manager"
+ApiKey = "key"
+
+[[alias]]
+source = "postmaster"
+destinations = ["root"]
+comment = "required by RFC 5321"
+
+[[alias]]
+source = "head.of.computing"
+destinations = ["computing@example.org"]
+mode = "replace"
+`)
+	defer cleanup()
+
+	c, err := NewConfigFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases := c.GetStaticAliases()
+	if len(aliases) != 2 || aliases[0].Mode != StaticAppend || aliases[1].Mode != StaticReplace {
+		t.Errorf("Expected two static aliases, appending then replacing, got %+v", aliases)
+	}
+	if line := c.Line("alias[1].mode"); line != 13 {
+		t.Errorf("Expected alias[1].mode on line 13, got %d", line)
+	}
+
+}
+
+func TestUtils_NewConfigFromFile_example(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "alias-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.toml")
+	if err := WriteExampleConfigToFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewConfigFromFile(file); err != nil {
+		t.Errorf("Expected the example config to be valid, got \n%s", err)
+	}
+
+}
+
+func TestUtils_WriteEffective(t *testing.T) {
+
+	file, cleanup := writeTestConfig(t, `HeadOfStation = "station.manager"
+AssistantHeadOfStation = "assistant.station.manager"
+ApiKey = "hunter3"
+Interval = "1h"
+
+[Serve]
+Token = "letmein"
+
+[[alias]]
+source = "postmaster"
+destinations = ["root"]
+`)
+	defer cleanup()
+	c, err := NewConfigFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := c.WriteEffective(&b, "exim"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`ApiKey = "[REDACTED]"`,
+		`Format = "exim"`,
+		`Interval = "1h0m0s"`,
+		`SnapshotMaxAge = "72h0m0s"`,
+		`FileMode = "0644"`,
+		`DanglingPolicy = "warn"`,
+		`Concurrency = 4`,
+		`Listen = "127.0.0.1:8025"`,
+		`Token = "[REDACTED]"`,
+		`InitialDelay = "1s"`,
+		"[[alias]]",
+		`mode = "append"`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("Expected '%s' in \n%s", expected, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "hunter3") || strings.Contains(b.String(), "letmein") {
+		t.Errorf("Expected the secrets to be redacted, got \n%s", b.String())
+	}
+
+}